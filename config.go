@@ -0,0 +1,146 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfile is the profile used when --profile isn't specified.
+const defaultProfile = "default"
+
+// config is the content of a config file, e.g.
+//
+//	profiles:
+//	  default:
+//	    project: my-project
+//	    instance: my-instance
+//	  prod:
+//	    project: my-project
+//	    instance: my-instance
+//	    database: prod
+//	    tables: [Singers, Albums]
+//
+// Keys of a profile are long names of the options.
+type config struct {
+	Profiles map[string]map[string]yaml.Node `yaml:"profiles"`
+}
+
+// defaultConfigPath returns the path of the config file used when --config isn't specified,
+// which is $XDG_CONFIG_HOME/spanner-dump/config.yaml or ~/.config/spanner-dump/config.yaml.
+func defaultConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "spanner-dump", "config.yaml"), nil
+}
+
+// applyConfig sets the options of the profile in the config file to opts.
+// Options specified by flags or environment variables take precedence over the config file.
+//
+// A missing default config file is ignored, but a missing file of --config and a missing profile of --profile are errors.
+func applyConfig(parser *flags.Parser, opts *options) error {
+	path := opts.Config
+	if path == "" {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			if opts.Profile != "" {
+				return fmt.Errorf("failed to find config file: %v", err)
+			}
+			return nil
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if opts.Config == "" && errors.Is(err, fs.ErrNotExist) {
+			if opts.Profile != "" {
+				return fmt.Errorf("profile %q is specified, but config file %s doesn't exist", opts.Profile, path)
+			}
+			return nil
+		}
+		return err
+	}
+
+	var cfg config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	name := opts.Profile
+	if name == "" {
+		name = defaultProfile
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		if opts.Profile == "" {
+			return nil
+		}
+		return fmt.Errorf("profile %q is not found in %s", name, path)
+	}
+
+	keys := make([]string, 0, len(profile))
+	for k := range profile {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	v := reflect.ValueOf(opts).Elem()
+	for _, k := range keys {
+		opt := parser.FindOptionByLongName(k)
+		if opt == nil || k == "config" || k == "profile" {
+			return fmt.Errorf("unknown option %q in profile %q of %s", k, name, path)
+		}
+		if opt.IsSet() && !opt.IsSetDefault() {
+			continue // specified by the flag
+		}
+		if _, ok := os.LookupEnv(opt.EnvDefaultKey); opt.EnvDefaultKey != "" && ok {
+			continue // specified by the environment variable
+		}
+		node := profile[k]
+		if err := decodeOption(&node, v.FieldByIndex(opt.Field().Index)); err != nil {
+			return fmt.Errorf("invalid value of %q in profile %q of %s: %v", k, name, path, err)
+		}
+	}
+	return nil
+}
+
+// decodeOption decodes the value of the node into the field of an option.
+// A sequence is decoded into a string field as comma-separated values, e.g. for "tables".
+func decodeOption(node *yaml.Node, field reflect.Value) error {
+	if node.Kind == yaml.SequenceNode && field.Kind() == reflect.String {
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		field.SetString(strings.Join(values, ","))
+		return nil
+	}
+	return node.Decode(field.Addr().Interface())
+}
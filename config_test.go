@@ -0,0 +1,221 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+)
+
+func TestApplyConfig(t *testing.T) {
+	const config = `profiles:
+  default:
+    project: default-project
+    instance: default-instance
+  prod:
+    project: prod-project
+    instance: prod-instance
+    database: prod-database
+    tables: [t1, t2]
+    staleness: 15s
+    bulk-size: 100
+    no-ddl: true
+  unknown-key:
+    project: prod-project
+    unknown: value
+  invalid-value:
+    bulk-size: many
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	for _, tt := range []struct {
+		desc    string
+		args    []string
+		env     map[string]string
+		want    options
+		wantErr string
+	}{
+		{
+			desc: "default profile",
+			args: []string{"--config", path},
+			want: options{ProjectId: "default-project", InstanceId: "default-instance"},
+		},
+		{
+			desc: "lists, durations and other types",
+			args: []string{"--config", path, "--profile", "prod"},
+			want: options{ProjectId: "prod-project", InstanceId: "prod-instance", DatabaseId: "prod-database",
+				Tables: "t1,t2", Staleness: "15s", BulkSize: 100, NoDDL: true},
+		},
+		{
+			desc: "flags take precedence",
+			args: []string{"--config", path, "--profile", "prod", "-p", "flag-project", "--tables", "t3"},
+			want: options{ProjectId: "flag-project", InstanceId: "prod-instance", DatabaseId: "prod-database",
+				Tables: "t3", Staleness: "15s", BulkSize: 100, NoDDL: true},
+		},
+		{
+			desc: "flags set to zero values take precedence",
+			args: []string{"--config", path, "--profile", "prod", "--bulk-size", "0", "--staleness", ""},
+			want: options{ProjectId: "prod-project", InstanceId: "prod-instance", DatabaseId: "prod-database",
+				Tables: "t1,t2", NoDDL: true},
+		},
+		{
+			desc: "environment variables take precedence",
+			args: []string{"--config", path, "--profile", "prod"},
+			env:  map[string]string{"SPANNER_PROJECT_ID": "env-project"},
+			want: options{ProjectId: "env-project", InstanceId: "prod-instance", DatabaseId: "prod-database",
+				Tables: "t1,t2", Staleness: "15s", BulkSize: 100, NoDDL: true},
+		},
+		{
+			desc: "profile from the environment variable",
+			args: []string{"--config", path},
+			env:  map[string]string{"SPANNER_DUMP_PROFILE": "prod"},
+			want: options{ProjectId: "prod-project", InstanceId: "prod-instance", DatabaseId: "prod-database",
+				Tables: "t1,t2", Staleness: "15s", BulkSize: 100, NoDDL: true},
+		},
+		{
+			desc:    "unknown profile",
+			args:    []string{"--config", path, "--profile", "staging"},
+			wantErr: `profile "staging" is not found`,
+		},
+		{
+			desc:    "unknown key",
+			args:    []string{"--config", path, "--profile", "unknown-key"},
+			wantErr: `unknown option "unknown"`,
+		},
+		{
+			desc:    "invalid value",
+			args:    []string{"--config", path, "--profile", "invalid-value"},
+			wantErr: `invalid value of "bulk-size"`,
+		},
+		{
+			desc:    "missing config file",
+			args:    []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: "no such file",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			for _, k := range []string{"SPANNER_PROJECT_ID", "SPANNER_INSTANCE_ID", "SPANNER_DATABASE_ID", "SPANNER_DUMP_PROFILE"} {
+				t.Setenv(k, "")
+				os.Unsetenv(k)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var opts options
+			parser := flags.NewParser(&opts, flags.None)
+			if _, err := parser.ParseArgs(tt.args); err != nil {
+				t.Fatalf("failed to parse %q: %v", tt.args, err)
+			}
+			err := applyConfig(parser, &opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("applyConfig() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyConfig() failed: %v", err)
+			}
+			// Config and Profile are compared separately, as they're specified by the test.
+			opts.Config, opts.Profile = "", ""
+			if opts != tt.want {
+				t.Errorf("applyConfig() = %+v, want = %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultConfigPath(t *testing.T) {
+	for _, tt := range []struct {
+		desc          string
+		xdgConfigHome string
+		home          string
+		want          string
+	}{
+		{
+			desc:          "XDG_CONFIG_HOME",
+			xdgConfigHome: "/xdg",
+			home:          "/home/user",
+			want:          "/xdg/spanner-dump/config.yaml",
+		},
+		{
+			desc: "home directory",
+			home: "/home/user",
+			want: "/home/user/.config/spanner-dump/config.yaml",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdgConfigHome)
+			t.Setenv("HOME", tt.home)
+			got, err := defaultConfigPath()
+			if err != nil {
+				t.Fatalf("defaultConfigPath() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("defaultConfigPath() = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_DefaultPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("SPANNER_DUMP_PROFILE", "")
+	os.Unsetenv("SPANNER_DUMP_PROFILE")
+
+	// A missing default config file is ignored unless a profile is specified.
+	var opts options
+	parser := flags.NewParser(&opts, flags.None)
+	if _, err := parser.ParseArgs(nil); err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if err := applyConfig(parser, &opts); err != nil {
+		t.Errorf("applyConfig() without config file failed: %v", err)
+	}
+	opts.Profile = "prod"
+	if err := applyConfig(parser, &opts); err == nil {
+		t.Errorf("applyConfig() with profile succeeded without config file")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "spanner-dump"), 0755); err != nil {
+		t.Fatalf("failed to create config directory: %v", err)
+	}
+	config := "profiles:\n  default:\n    project: default-project\n"
+	if err := os.WriteFile(filepath.Join(dir, "spanner-dump", "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	opts = options{}
+	parser = flags.NewParser(&opts, flags.None)
+	if _, err := parser.ParseArgs(nil); err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if err := applyConfig(parser, &opts); err != nil {
+		t.Fatalf("applyConfig() failed: %v", err)
+	}
+	if opts.ProjectId != "default-project" {
+		t.Errorf("ProjectId = %q, want = %q", opts.ProjectId, "default-project")
+	}
+}
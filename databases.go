@@ -0,0 +1,165 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+)
+
+// defaultConcurrency is the default number of databases dumped concurrently.
+const defaultConcurrency = 4
+
+// runDumpDatabases dumps the databases of --databases or --all-databases into their own subdirectories
+// of the output directory concurrently, and writes an instance manifest.
+// A failure of a database doesn't stop the others, and the program exits with exitIncomplete after all of them finish,
+// or with exitPermission if any of them failed with a permission error.
+func runDumpDatabases(ctx context.Context, dumpOpts dump.Options, opts options) {
+	if opts.AllDatabases && opts.Databases != "" {
+		usagef("--all-databases can't be used with --databases\n")
+	}
+	if opts.OutputDir == "" {
+		usagef("--output-dir is required to dump multiple databases\n")
+	}
+	if opts.ProtoDescriptorsFile != "" {
+		usagef("--proto-descriptors-file can't be used with multiple databases, as descriptors are written into each directory\n")
+	}
+	if opts.Progress && opts.Concurrency != 1 {
+		usagef("--progress can't be used with multiple databases unless --concurrency=1\n")
+	}
+
+	var databases []string
+	if opts.AllDatabases {
+		var err error
+		if databases, err = dump.ListDatabases(ctx, dumpOpts); err != nil {
+			exitWithCode(exitCode(ctx, err), "Failed to list databases: %v\n", err)
+		}
+	} else {
+		var err error
+		if databases, err = parseDatabases(opts.Databases); err != nil {
+			usagef("Invalid --databases: %v\n", err)
+		}
+	}
+	if len(databases) == 0 {
+		exitf("No databases to dump in instance %s\n", opts.InstanceId)
+	}
+
+	_, failures, err := dumpDatabases(ctx, dumpOpts, opts, databases)
+	if err != nil {
+		exitf("Failed to write instance manifest: %v\n", err)
+	}
+	if len(failures) > 0 {
+		code := exitIncomplete
+		for _, err := range failures {
+			if exitCode(ctx, err) == exitPermission {
+				code = exitPermission
+			}
+		}
+		exitWithCode(code, "Failed to dump %d of %d databases\n", len(failures), len(databases))
+	}
+}
+
+// parseDatabases parses comma-separated database IDs of --databases. Duplicated IDs are dumped once.
+func parseDatabases(s string) ([]string, error) {
+	var databases []string
+	seen := map[string]bool{}
+	for _, database := range strings.Split(s, ",") {
+		database = strings.TrimSpace(database)
+		if database == "" {
+			return nil, fmt.Errorf("empty database ID in %q", s)
+		}
+		if seen[database] {
+			continue
+		}
+		seen[database] = true
+		databases = append(databases, database)
+	}
+	return databases, nil
+}
+
+// dumpDatabases dumps the databases into their own subdirectories of the output directory concurrently,
+// and writes the instance manifest. Failures of databases are recorded in the manifest and returned as failures,
+// and the returned error is only for the instance manifest.
+func dumpDatabases(ctx context.Context, dumpOpts dump.Options, opts options, databases []string) (manifest *dump.InstanceManifest, failures []error, err error) {
+	concurrency := int(opts.Concurrency)
+	if concurrency == 0 {
+		concurrency = defaultConcurrency
+	}
+	manifest = &dump.InstanceManifest{
+		Instance:  fmt.Sprintf("projects/%s/instances/%s", opts.ProjectId, opts.InstanceId),
+		Databases: make([]dump.DatabaseManifest, len(databases)),
+	}
+	errs := make([]error, len(databases))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, database := range databases {
+		wg.Add(1)
+		go func(i int, database string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			dbDumpOpts := dumpOpts
+			dbDumpOpts.Database = database
+			dbOpts := opts
+			dbOpts.OutputDir = filepath.Join(opts.OutputDir, database)
+			if opts.Stats != "" {
+				dbOpts.Stats = filepath.Join(dbOpts.OutputDir, filepath.Base(opts.Stats))
+			}
+
+			m := dump.DatabaseManifest{Database: database, Dir: database, Status: dump.StatusComplete}
+			dbManifest, err := dumpToDir(ctx, dbDumpOpts, dbOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to dump database %s: %v\n", database, err)
+				m.Status = dump.StatusIncomplete
+				m.Error = err.Error()
+				errs[i] = err
+			} else {
+				if !dbManifest.ReadTimestamp.IsZero() {
+					m.ReadTimestamp = &dbManifest.ReadTimestamp
+				}
+				m.Tables = len(dbManifest.Tables)
+			}
+			manifest.Databases[i] = m
+		}(i, database)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	f, err := os.Create(filepath.Join(opts.OutputDir, instanceManifestFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if err := manifest.Write(f); err != nil {
+		return nil, nil, err
+	}
+	return manifest, failures, nil
+}
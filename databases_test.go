@@ -0,0 +1,121 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+	"github.com/cloudspannerecosystem/spanner-dump/internal/fakespanner"
+)
+
+func TestParseDatabases(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{desc: "single", input: "db1", want: []string{"db1"}},
+		{desc: "multiple", input: "db1,db2", want: []string{"db1", "db2"}},
+		{desc: "spaces", input: " db1 , db2 ", want: []string{"db1", "db2"}},
+		{desc: "duplicated", input: "db1,db2,db1", want: []string{"db1", "db2"}},
+		{desc: "empty entry", input: "db1,,db2", wantErr: true},
+		{desc: "trailing comma", input: "db1,", wantErr: true},
+		{desc: "blank entry", input: "db1, ", wantErr: true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := parseDatabases(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseDatabases(%q) = %q, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDatabases(%q) failed: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDatabases(%q) = %q, want = %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpDatabases(t *testing.T) {
+	server, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	defer server.Close()
+	// Only db1 exists, so the dump of db2 fails.
+	server.SetDDLs("projects/fake-project/instances/fake-instance/databases/db1", []string{
+		"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+	})
+
+	dir := t.TempDir()
+	dumpOpts := dump.Options{
+		Project:  "fake-project",
+		Instance: "fake-instance",
+		Endpoint: server.Addr(),
+		Insecure: true,
+	}
+	opts := options{ProjectId: "fake-project", InstanceId: "fake-instance", OutputDir: dir, NoData: true}
+	manifest, failures, err := dumpDatabases(context.Background(), dumpOpts, opts, []string{"db1", "db2"})
+	if err != nil {
+		t.Fatalf("dumpDatabases() failed: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Error() != manifest.Databases[1].Error {
+		t.Errorf("failures = %v, want the failure of db2", failures)
+	}
+
+	if manifest.Instance != "projects/fake-project/instances/fake-instance" || len(manifest.Databases) != 2 {
+		t.Fatalf("manifest = %+v, want 2 databases of fake-instance", manifest)
+	}
+	db1, db2 := manifest.Databases[0], manifest.Databases[1]
+	if db1.Database != "db1" || db1.Dir != "db1" || db1.Status != dump.StatusComplete || db1.Error != "" {
+		t.Errorf("manifest of db1 = %+v, want complete", db1)
+	}
+	if db2.Database != "db2" || db2.Dir != "db2" || db2.Status != dump.StatusIncomplete || db2.Error == "" {
+		t.Errorf("manifest of db2 = %+v, want incomplete with error", db2)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, instanceManifestFile))
+	if err != nil {
+		t.Fatalf("failed to read instance manifest: %v", err)
+	}
+	var written dump.InstanceManifest
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatalf("failed to parse instance manifest: %v", err)
+	}
+	if !reflect.DeepEqual(&written, manifest) {
+		t.Errorf("instance manifest = %+v, want = %+v", written, manifest)
+	}
+
+	b, err = os.ReadFile(filepath.Join(dir, "db1", schemaFile))
+	if err != nil {
+		t.Fatalf("failed to read schema of db1: %v", err)
+	}
+	if want := "CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id);\n"; string(b) != want {
+		t.Errorf("schema of db1 = %q, want = %q", b, want)
+	}
+}
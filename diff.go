@@ -0,0 +1,95 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+)
+
+type diffOptions struct {
+	ToProjectId  string `long:"to-project" description:"GCP Project ID of the target. Default is the same as the source."`
+	ToInstanceId string `long:"to-instance" description:"Cloud Spanner Instance ID of the target. Default is the same as the source."`
+	ToDatabaseId string `long:"to-database" description:"Cloud Spanner Database ID of the target. Default is the same as the source."`
+	ToTimestamp  string `long:"to-timestamp" description:"Timestamp for the target snapshot in the RFC 3339 format, or relative to the current time. Default is a strong read at the current time, regardless of --timestamp, --staleness and --max-staleness of the source."`
+	DML          bool   `long:"dml" description:"Output DML statements which transform the source into the target."`
+}
+
+// runDiff compares data of the source specified by the application options with the target, and writes differing rows.
+func runDiff(ctx context.Context, dumpOpts dump.Options, opts diffOptions) {
+	toOpts := targetOptions(dumpOpts, parseTimestamp(opts.ToTimestamp))
+	if opts.ToProjectId != "" {
+		toOpts.Project = opts.ToProjectId
+	}
+	if opts.ToInstanceId != "" {
+		toOpts.Instance = opts.ToInstanceId
+	}
+	if opts.ToDatabaseId != "" {
+		toOpts.Database = opts.ToDatabaseId
+	}
+	if toOpts.Project == dumpOpts.Project && toOpts.Instance == dumpOpts.Instance && toOpts.Database == dumpOpts.Database &&
+		sameTimestampBound(dumpOpts, toOpts) {
+		usagef("Missing parameters: --to-database or timestamps are required to compare different sources\n")
+	}
+
+	from, err := dump.NewDumper(ctx, dumpOpts)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+	}
+	exitHooks = append(exitHooks, from.Cleanup)
+	to, err := dump.NewDumper(ctx, toOpts)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+	}
+	exitHooks = append(exitHooks, to.Cleanup)
+
+	counts := map[dump.DiffKind]int{}
+	if err := dump.Diff(ctx, from, to, func(d *dump.RowDiff) error {
+		counts[d.Kind]++
+		if opts.DML {
+			_, err := fmt.Println(d.DML())
+			return err
+		}
+		_, err := fmt.Println(d.String())
+		return err
+	}); err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to compare data: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d inserted, %d deleted, %d changed\n", counts[dump.RowInserted], counts[dump.RowDeleted], counts[dump.RowChanged])
+}
+
+// targetOptions returns the options of the source with the timestamp bound of the target.
+// The target is read at the timestamp, or strongly if it's nil. The bound of the source is never inherited.
+func targetOptions(dumpOpts dump.Options, timestamp *time.Time) dump.Options {
+	toOpts := dumpOpts
+	toOpts.Timestamp = timestamp
+	toOpts.Staleness = 0
+	toOpts.MaxStaleness = 0
+	return toOpts
+}
+
+// sameTimestampBound returns true if the options have the same timestamp bound, e.g. strong reads in both.
+func sameTimestampBound(a, b dump.Options) bool {
+	if a.Timestamp != nil || b.Timestamp != nil {
+		return a.Timestamp != nil && b.Timestamp != nil && a.Timestamp.Equal(*b.Timestamp)
+	}
+	return a.Staleness == b.Staleness && a.MaxStaleness == b.MaxStaleness
+}
@@ -0,0 +1,75 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+)
+
+func TestTargetOptions(t *testing.T) {
+	ts1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 := ts1.Add(time.Second)
+	for _, tt := range []struct {
+		desc      string
+		source    dump.Options
+		timestamp *time.Time
+		want      dump.Options
+	}{
+		{desc: "strong read", want: dump.Options{}},
+		{desc: "timestamp", source: dump.Options{Timestamp: &ts1}, want: dump.Options{}},
+		{desc: "staleness", source: dump.Options{Staleness: time.Minute}, want: dump.Options{}},
+		{desc: "max staleness", source: dump.Options{MaxStaleness: time.Minute}, want: dump.Options{}},
+		{desc: "to timestamp", source: dump.Options{Timestamp: &ts1}, timestamp: &ts2, want: dump.Options{Timestamp: &ts2}},
+		{desc: "to timestamp with staleness", source: dump.Options{Staleness: time.Minute}, timestamp: &ts2, want: dump.Options{Timestamp: &ts2}},
+		{desc: "other options", source: dump.Options{Database: "db1", MaxStaleness: time.Minute}, want: dump.Options{Database: "db1"}},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := targetOptions(tt.source, tt.timestamp)
+			if got.Database != tt.want.Database || !sameTimestampBound(got, tt.want) {
+				t.Errorf("targetOptions() = %+v, want = %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameTimestampBound(t *testing.T) {
+	ts1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts2 := ts1.Add(time.Second)
+	for _, tt := range []struct {
+		desc string
+		a, b dump.Options
+		want bool
+	}{
+		{desc: "strong reads", want: true},
+		{desc: "same timestamp", a: dump.Options{Timestamp: &ts1}, b: dump.Options{Timestamp: &ts1}, want: true},
+		{desc: "different timestamps", a: dump.Options{Timestamp: &ts1}, b: dump.Options{Timestamp: &ts2}, want: false},
+		{desc: "timestamp and strong read", a: dump.Options{}, b: dump.Options{Timestamp: &ts1}, want: false},
+		{desc: "same staleness", a: dump.Options{Staleness: time.Minute}, b: dump.Options{Staleness: time.Minute}, want: true},
+		{desc: "staleness and strong read", a: dump.Options{Staleness: time.Minute}, b: dump.Options{}, want: false},
+		{desc: "staleness and max staleness", a: dump.Options{Staleness: time.Minute}, b: dump.Options{MaxStaleness: time.Minute}, want: false},
+		{desc: "staleness and timestamp", a: dump.Options{Staleness: time.Minute}, b: dump.Options{Timestamp: &ts1}, want: false},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := sameTimestampBound(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameTimestampBound() = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+}
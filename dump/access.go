@@ -0,0 +1,142 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+)
+
+// readableTables returns copies of the tables with only the columns which the database role can read.
+// Tables which the role can't read at all, or whose primary key columns it can't read, are omitted.
+// Omitted tables and columns are reported as warnings.
+//
+// Privileges are checked by queries which return no rows, as they may be granted through inherited roles.
+func (d *Dumper) readableTables(ctx context.Context, txn *spanner.ReadOnlyTransaction, tables []*Table) ([]*Table, error) {
+	readable := make([]*Table, 0, len(tables))
+	for _, t := range tables {
+		ok, err := d.canRead(ctx, txn, t, t.Columns)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			readable = append(readable, t)
+			continue
+		}
+
+		keys := map[string]bool{}
+		for _, k := range t.PrimaryKeys {
+			keys[k] = true
+		}
+		table := *t
+		table.Columns = nil
+		var skipped []string
+		keyReadable := true
+		for _, c := range t.Columns {
+			ok, err := d.canRead(ctx, txn, t, []Column{c})
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case ok:
+				table.Columns = append(table.Columns, c)
+			case keys[c.Name]:
+				keyReadable = false
+			default:
+				skipped = append(skipped, c.Name)
+			}
+		}
+		if !keyReadable || len(table.Columns) == 0 {
+			d.warnf("Skipped table %s, which database role %s can't read\n", t.Name, d.databaseRole)
+			continue
+		}
+		if len(skipped) > 0 {
+			d.warnf("Skipped columns of table %s, which database role %s can't read: %s\n", t.Name, d.databaseRole, strings.Join(skipped, ", "))
+		}
+		readable = append(readable, &table)
+	}
+	return readable, nil
+}
+
+// canRead returns true if the columns of the table can be read. It returns an error if the query fails
+// for a reason other than a lack of privileges.
+func (d *Dumper) canRead(ctx context.Context, txn *spanner.ReadOnlyTransaction, table *Table, columns []Column) (bool, error) {
+	probe := &Table{Name: table.Name, Columns: columns}
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT %s FROM `%s` LIMIT 0", probe.selectList(), table.Name))
+	err := txn.QueryWithOptions(ctx, stmt, d.queryOptions(table.Name+"/check-access")).Do(func(*spanner.Row) error {
+		return nil
+	})
+	switch {
+	case err == nil:
+		return true, nil
+	case spanner.ErrCode(err) == codes.PermissionDenied:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check access to %s: %w", table.Name, err)
+	}
+}
+
+// readableTableNames returns the names of the tables which the database role can read,
+// limited by Options.Tables if it's set.
+func (d *Dumper) readableTableNames(ctx context.Context) (map[string]bool, error) {
+	txn, err := d.readOnlyTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Close()
+
+	iter, err := d.fetchTables(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	var tables []*Table
+	if err := iter.Do(func(t *Table) error {
+		if len(d.tables) == 0 || d.tables[t.Name] {
+			tables = append(tables, t)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if tables, err = d.readableTables(ctx, txn, tables); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, t := range tables {
+		names[t.Name] = true
+	}
+	return names, nil
+}
+
+// warnf writes a warning to Options.Warnings. The same warning is written only once,
+// as the same tables are checked by both DumpDDLs and DumpTables.
+func (d *Dumper) warnf(format string, a ...interface{}) {
+	if d.warnings == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	if d.warned[msg] {
+		return
+	}
+	d.warned[msg] = true
+	fmt.Fprint(d.warnings, msg)
+}
@@ -0,0 +1,160 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// TableChecksum is the number of rows and the checksum of a table.
+//
+// The checksum doesn't depend on the order of rows, so it can be compared with
+// the one computed from the same data read in a different order.
+type TableChecksum struct {
+	Name     string `json:"name"`
+	Rows     int64  `json:"rows"`
+	Checksum string `json:"checksum"`
+}
+
+// ChecksumEncoder is a RowEncoder to compute TableChecksum of each table.
+//
+// If a writer for row checksums is given, it also writes a checksum of each row with the primary key,
+// which is a line of "<table>\t<primary key>\t<row checksum>".
+// Row checksums are used to find differing rows by Dumper.Verify.
+type ChecksumEncoder struct {
+	rowOut *bufio.Writer
+
+	table     *Table
+	keyIndex  []int
+	rows      int64
+	sum       uint64
+	checksums []TableChecksum
+}
+
+// NewChecksumEncoder creates ChecksumEncoder. rowOut may be nil.
+func NewChecksumEncoder(rowOut io.Writer) *ChecksumEncoder {
+	e := &ChecksumEncoder{}
+	if rowOut != nil {
+		e.rowOut = bufio.NewWriter(rowOut)
+	}
+	return e
+}
+
+// Checksums returns checksums of the tables encoded so far.
+func (e *ChecksumEncoder) Checksums() []TableChecksum {
+	return e.checksums
+}
+
+// BeginTable implements RowEncoder.
+func (e *ChecksumEncoder) BeginTable(table *Table) error {
+	e.table = table
+	e.keyIndex = primaryKeyIndex(table)
+	e.rows = 0
+	e.sum = 0
+	return nil
+}
+
+// WriteRow implements RowEncoder.
+func (e *ChecksumEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	decoded, checksum, err := decodeRowChecksum(values)
+	if err != nil {
+		return err
+	}
+
+	e.rows++
+	// Sum is used to combine row checksums as it doesn't depend on the order of rows.
+	e.sum += checksum
+
+	if e.rowOut != nil {
+		if _, err := fmt.Fprintf(e.rowOut, "%s\t%s\t%016x\n", e.table.Name, primaryKeyString(decoded, e.keyIndex), checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndTable implements RowEncoder.
+func (e *ChecksumEncoder) EndTable() error {
+	e.checksums = append(e.checksums, TableChecksum{
+		Name:     e.table.Name,
+		Rows:     e.rows,
+		Checksum: fmt.Sprintf("%016x", e.sum),
+	})
+	e.table = nil
+	if e.rowOut != nil {
+		return e.rowOut.Flush()
+	}
+	return nil
+}
+
+// Finish implements RowEncoder.
+func (e *ChecksumEncoder) Finish() error {
+	return nil
+}
+
+// decodeRowChecksum decodes values and returns them with a checksum of the row.
+func decodeRowChecksum(values []spanner.GenericColumnValue) ([]string, uint64, error) {
+	decoded := make([]string, len(values))
+	for i, v := range values {
+		s, err := DecodeColumn(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		decoded[i] = s
+	}
+	return decoded, rowChecksum(decoded), nil
+}
+
+// rowChecksum returns a checksum of a row from its decoded values.
+func rowChecksum(decoded []string) uint64 {
+	h := sha256.New()
+	for _, v := range decoded {
+		// Decoded values never contain NUL, so it can be used as a separator.
+		io.WriteString(h, v)
+		h.Write([]byte{0})
+	}
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// primaryKeyIndex returns the positions of primary key columns in the table columns.
+func primaryKeyIndex(table *Table) []int {
+	var index []int
+	for _, pk := range table.PrimaryKeys {
+		for i, c := range table.Columns {
+			if c.Name == pk {
+				index = append(index, i)
+				break
+			}
+		}
+	}
+	return index
+}
+
+func primaryKeyString(decoded []string, keyIndex []int) string {
+	key := make([]string, len(keyIndex))
+	for i, idx := range keyIndex {
+		key[i] = decoded[idx]
+	}
+	return "(" + strings.Join(key, ", ") + ")"
+}
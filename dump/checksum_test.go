@@ -0,0 +1,52 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChecksumEncoder(t *testing.T) {
+	table := &Table{Name: "t1", Columns: []Column{{Name: "Id"}, {Name: "Name"}}, PrimaryKeys: []string{"Id"}}
+
+	checksum := func(rows [][]interface{}) (TableChecksum, string) {
+		out := &bytes.Buffer{}
+		encoder := NewChecksumEncoder(out)
+		encodeTables(t, encoder, []*Table{table}, [][][]interface{}{rows})
+		return encoder.Checksums()[0], out.String()
+	}
+
+	got1, rows1 := checksum([][]interface{}{{int64(1), "foo"}, {int64(2), "bar"}})
+	got2, _ := checksum([][]interface{}{{int64(2), "bar"}, {int64(1), "foo"}})
+	got3, _ := checksum([][]interface{}{{int64(1), "foo"}, {int64(2), "baz"}})
+
+	if got1.Name != "t1" || got1.Rows != 2 {
+		t.Errorf("Checksums() = %+v, want name = t1, rows = 2", got1)
+	}
+	if got1 != got2 {
+		t.Errorf("checksum depends on the order of rows: %+v, %+v", got1, got2)
+	}
+	if got1 == got3 {
+		t.Errorf("checksum doesn't change for different rows: %+v, %+v", got1, got3)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix([]byte(rows1), []byte("\n")), []byte("\n"))
+	if len(lines) != 2 || !bytes.HasPrefix(lines[0], []byte("t1\t(1)\t")) || !bytes.HasPrefix(lines[1], []byte("t1\t(2)\t")) {
+		t.Errorf("row checksums = %q, want lines of table, primary key and checksum", rows1)
+	}
+}
@@ -0,0 +1,115 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// FormatCSV is the output format of comma-separated values.
+const FormatCSV = "csv"
+
+// CSVEncoder is a RowEncoder to write records as CSV.
+//
+// Each table starts with a header record of the column names, and tables are separated by an empty line.
+// Values are written in the text representation of the Spanner wire format, e.g. BYTES is base64-encoded,
+// and arrays are written as JSON arrays. NULL is written as EncoderOptions.CSVNull, which is an empty field by default.
+type CSVEncoder struct {
+	out    io.Writer
+	writer *csv.Writer
+	null   string
+	tables int
+}
+
+// NewCSVEncoder creates CSVEncoder.
+func NewCSVEncoder(out io.Writer, opts EncoderOptions) RowEncoder {
+	return &CSVEncoder{
+		out:    out,
+		writer: csv.NewWriter(out),
+		null:   opts.CSVNull,
+	}
+}
+
+// BeginTable implements RowEncoder.
+func (e *CSVEncoder) BeginTable(table *Table) error {
+	if e.tables > 0 {
+		if _, err := io.WriteString(e.out, "\n"); err != nil {
+			return err
+		}
+	}
+	e.tables++
+
+	header := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		header[i] = c.Name
+	}
+	return e.writer.Write(header)
+}
+
+// WriteRow implements RowEncoder.
+func (e *CSVEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		if _, ok := v.Value.GetKind().(*structpb.Value_NullValue); ok {
+			record[i] = e.null
+			continue
+		}
+		s, err := wireValueToText(v.Value)
+		if err != nil {
+			return err
+		}
+		record[i] = s
+	}
+	return e.writer.Write(record)
+}
+
+// EndTable implements RowEncoder.
+func (e *CSVEncoder) EndTable() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// Finish implements RowEncoder.
+func (e *CSVEncoder) Finish() error {
+	return nil
+}
+
+// wireValueToText converts a value in the Spanner wire format into a plain text.
+func wireValueToText(v *structpb.Value) (string, error) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_NullValue, nil:
+		return "", nil
+	case *structpb.Value_StringValue:
+		return k.StringValue, nil
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(k.BoolValue), nil
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(k.NumberValue, 'g', -1, 64), nil
+	default:
+		b, err := json.Marshal(v.AsInterface())
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
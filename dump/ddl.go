@@ -0,0 +1,790 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent       tokenKind = iota // identifier or keyword, e.g. CREATE, Singers
+	tokenQuotedIdent                  // identifier enclosed by backticks, e.g. `Singers`
+	tokenString                       // string or bytes literal, e.g. "foo", b'bar'
+	tokenNumber                       // number literal, e.g. 1, 0x1F, 1.5e3
+	tokenSymbol                       // single character symbol, e.g. (, ), <, ;
+)
+
+// token is a lexical token in SQL.
+type token struct {
+	kind tokenKind
+	// text is the original text of the token.
+	text string
+	// start and end are the byte offsets of the token in the SQL.
+	start, end int
+}
+
+// value returns the identifier without backticks for an identifier, or the original text for other tokens.
+func (t token) value() string {
+	if t.kind == tokenQuotedIdent {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], "\\`", "`")
+	}
+	return t.text
+}
+
+// isKeyword returns true if the token is the given keyword, which is compared case-insensitively.
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) isSymbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+// tokenize splits SQL into tokens. Whitespaces and comments are skipped.
+func tokenize(sql string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case c == '#' || strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed comment at offset %d", i)
+			}
+			i += end + 4
+		case c == '`':
+			end, err := scanQuoted(sql, i, "`")
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenQuotedIdent, text: sql[i:end], start: i, end: end})
+			i = end
+		case c == '"' || c == '\'':
+			end, err := scanString(sql, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sql[i:end], start: i, end: end})
+			i = end
+		case isIdentStart(c):
+			end := i
+			for end < len(sql) && isIdentPart(sql[end]) {
+				end++
+			}
+			// String prefixes, e.g. r"...", b'...', rb"..."
+			if end < len(sql) && (sql[end] == '"' || sql[end] == '\'') && isStringPrefix(sql[i:end]) {
+				strEnd, err := scanString(sql, end)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token{kind: tokenString, text: sql[i:strEnd], start: i, end: strEnd})
+				i = strEnd
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: sql[i:end], start: i, end: end})
+			i = end
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			end := i
+			for end < len(sql) && (isIdentPart(sql[end]) || sql[end] == '.' ||
+				((sql[end] == '+' || sql[end] == '-') && (sql[end-1] == 'e' || sql[end-1] == 'E'))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: sql[i:end], start: i, end: end})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: sql[i : i+1], start: i, end: i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isStringPrefix(s string) bool {
+	switch strings.ToLower(s) {
+	case "r", "b", "rb", "br":
+		return true
+	default:
+		return false
+	}
+}
+
+// scanString returns the end offset of the string literal starting at the offset, which may be triple-quoted.
+func scanString(sql string, start int) (int, error) {
+	quote := sql[start : start+1]
+	if strings.HasPrefix(sql[start:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	return scanQuoted(sql, start, quote)
+}
+
+// scanQuoted returns the end offset of the text enclosed by the quote, which can be escaped by a backslash.
+func scanQuoted(sql string, start int, quote string) (int, error) {
+	i := start + len(quote)
+	for i < len(sql) {
+		if sql[i] == '\\' {
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(sql[i:], quote) {
+			return i + len(quote), nil
+		}
+		i++
+	}
+	return 0, fmt.Errorf("unclosed quote %s at offset %d", quote, start)
+}
+
+// SplitStatements splits SQL text into statements separated by semicolons, e.g. a file created by DumpDDLs.
+// Comments outside of statements are removed, and statements don't have trailing semicolons.
+func SplitStatements(sql string) ([]string, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	first := -1
+	for i, t := range tokens {
+		if t.isSymbol(";") {
+			if first >= 0 {
+				stmts = append(stmts, sql[tokens[first].start:tokens[i-1].end])
+			}
+			first = -1
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first >= 0 {
+		stmts = append(stmts, sql[tokens[first].start:tokens[len(tokens)-1].end])
+	}
+	return stmts, nil
+}
+
+// normalizeTokens returns a canonical text of the tokens to compare statements ignoring whitespaces,
+// comments, letter cases and backticks of identifiers, which don't change the meaning of DDL.
+func normalizeTokens(tokens []token) string {
+	var sb strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		switch t.kind {
+		case tokenIdent, tokenQuotedIdent:
+			sb.WriteString(strings.ToUpper(t.value()))
+		default:
+			sb.WriteString(t.text)
+		}
+	}
+	return sb.String()
+}
+
+// tokensText returns the original text spanning the tokens.
+func tokensText(sql string, tokens []token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	return sql[tokens[0].start:tokens[len(tokens)-1].end]
+}
+
+// splitTopLevel splits tokens by the separator symbol which is not enclosed by parentheses or angle brackets.
+// Angle brackets are considered only outside of parentheses, as they are operators in expressions.
+func splitTopLevel(tokens []token, separator string) [][]token {
+	var parts [][]token
+	parens, angles := 0, 0
+	start := 0
+	for i, t := range tokens {
+		switch {
+		case t.isSymbol("("):
+			parens++
+		case t.isSymbol(")"):
+			parens--
+		case parens == 0 && t.isSymbol("<"):
+			angles++
+		case parens == 0 && t.isSymbol(">"):
+			angles--
+		case parens == 0 && angles == 0 && t.isSymbol(separator):
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, tokens[start:])
+	}
+	return parts
+}
+
+// findClosingParen returns the index of the parenthesis closing the one at the index.
+func findClosingParen(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case tokens[i].isSymbol("("):
+			depth++
+		case tokens[i].isSymbol(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseName parses a possibly qualified name, e.g. `sch`.Singers, from the index,
+// and returns the name tokens and the index of the next token.
+func parseName(tokens []token, i int) ([]token, int) {
+	start := i
+	for i < len(tokens) && (tokens[i].kind == tokenIdent || tokens[i].kind == tokenQuotedIdent) {
+		i++
+		if i+1 < len(tokens) && tokens[i].isSymbol(".") {
+			i++
+			continue
+		}
+		break
+	}
+	return tokens[start:i], i
+}
+
+// nameValue returns the name without backticks, e.g. "sch.Singers".
+func nameValue(name []token) string {
+	var parts []string
+	for _, t := range name {
+		if !t.isSymbol(".") {
+			parts = append(parts, t.value())
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ddlStatement is a parsed DDL statement.
+type ddlStatement struct {
+	// key identifies the object defined by the statement in a schema, e.g. "INDEX SINGERSBYNAME".
+	// It's the normalized statement for a statement which doesn't define a named object.
+	key string
+	// kind is the kind of the object defined by the statement, e.g. "TABLE", "SEARCH INDEX", "CONSTRAINT".
+	// It's empty for a statement which doesn't define a named object, e.g. GRANT.
+	kind string
+	// name is the original text of the object name.
+	name string
+	// objectName is the object name without backticks.
+	objectName string
+	// table is the original text of the table name that the statement belongs to,
+	// e.g. the table itself of CREATE TABLE, the table of an index, or the altered table.
+	table string
+	// tableName is the table name without backticks.
+	tableName string
+	// parent is the original text of the parent table name of an interleaved table.
+	parent string
+	// dependencies are the names without backticks of objects which the statement refers to,
+	// e.g. the parent table, tables referenced by foreign keys or a view, or roles granted privileges.
+	dependencies []string
+	// allTables is true for a change stream which watches all tables.
+	allTables bool
+
+	text       string
+	tokens     []token
+	normalized string
+
+	// The rest are only for tables.
+	columns           []tableElement
+	constraints       []tableElement
+	primaryKey        string // normalized PRIMARY KEY and INTERLEAVE clauses with key column definitions
+	rowDeletionPolicy []token
+}
+
+// tableElement is a column or a constraint in CREATE TABLE.
+type tableElement struct {
+	key        string
+	name       string
+	tokens     []token
+	normalized string
+}
+
+// namedObjectKinds are object kinds which follow CREATE, ALTER or GRANT ... ON.
+// Kinds of multiple words come before their prefixes, e.g. TABLE FUNCTION before TABLE.
+// UNIQUE and NULL_FILTERED of indexes are skipped before the kind by parseDDL.
+var namedObjectKinds = [][]string{
+	{"TABLE", "FUNCTION"},
+	{"TABLE"},
+	{"INDEX"},
+	{"SEARCH", "INDEX"},
+	{"VECTOR", "INDEX"},
+	{"CHANGE", "STREAM"},
+	{"PROTO", "BUNDLE"},
+	{"SEQUENCE"},
+	{"VIEW"},
+	{"ROLE"},
+	{"MODEL"},
+	{"SCHEMA"},
+	{"FUNCTION"},
+}
+
+// parseDDL parses a DDL statement.
+func parseDDL(stmt string) (*ddlStatement, error) {
+	tokens, err := tokenize(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) > 0 && tokens[len(tokens)-1].isSymbol(";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty statement")
+	}
+	obj := &ddlStatement{
+		text:       tokensText(stmt, tokens),
+		tokens:     tokens,
+		normalized: normalizeTokens(tokens),
+	}
+	obj.key = obj.normalized
+
+	switch {
+	case tokens[0].isKeyword("CREATE"):
+		i := 1
+		if i+1 < len(tokens) && tokens[i].isKeyword("OR") && tokens[i+1].isKeyword("REPLACE") {
+			i += 2
+		}
+		for i < len(tokens) && (tokens[i].isKeyword("UNIQUE") || tokens[i].isKeyword("NULL_FILTERED")) {
+			i++
+		}
+		kind, i := parseObjectKind(tokens, i)
+		if kind == "" {
+			return obj, nil
+		}
+		obj.kind = kind
+		if i+2 < len(tokens) && tokens[i].isKeyword("IF") && tokens[i+1].isKeyword("NOT") && tokens[i+2].isKeyword("EXISTS") {
+			i += 3
+		}
+		if obj.kind == "PROTO BUNDLE" {
+			obj.key = obj.kind
+			return obj, nil
+		}
+		name, next := parseName(tokens, i)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("missing name: %s", stmt)
+		}
+		obj.name = tokensText(obj.text, name)
+		obj.objectName = nameValue(name)
+		obj.key = obj.kind + " " + strings.ToUpper(obj.objectName)
+		if len(name) > 1 {
+			// Objects in a named schema depend on the schema.
+			obj.dependencies = append(obj.dependencies, name[0].value())
+		}
+		switch {
+		case obj.kind == "TABLE":
+			obj.setTable(name)
+			if err := obj.parseTable(tokens[next:]); err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(obj.kind, "INDEX") && next < len(tokens) && tokens[next].isKeyword("ON"):
+			table, _ := parseName(tokens, next+1)
+			obj.setTable(table)
+		}
+	case len(tokens) > 2 && tokens[0].isKeyword("ALTER") && tokens[1].isKeyword("DATABASE"):
+		obj.kind = "DATABASE"
+		obj.key = "DATABASE"
+	case tokens[0].isKeyword("ALTER"):
+		kind, i := parseObjectKind(tokens, 1)
+		name, next := parseName(tokens, i)
+		switch kind {
+		case "TABLE":
+			obj.setTable(name)
+			// Foreign keys are dumped as ALTER TABLE t ADD CONSTRAINT fk FOREIGN KEY ...
+			if next+2 < len(tokens) && tokens[next].isKeyword("ADD") && tokens[next+1].isKeyword("CONSTRAINT") {
+				constraint, _ := parseName(tokens, next+2)
+				obj.kind = "CONSTRAINT"
+				obj.name = tokensText(obj.text, constraint)
+				obj.objectName = nameValue(constraint)
+				obj.key = fmt.Sprintf("CONSTRAINT %s.%s", strings.ToUpper(obj.tableName), strings.ToUpper(obj.objectName))
+			}
+		case "INDEX", "SEARCH INDEX", "VECTOR INDEX":
+			// The table of the index is resolved by parseDDLs.
+		default:
+			if len(name) > 0 {
+				obj.dependencies = append(obj.dependencies, nameValue(name))
+			}
+		}
+	case tokens[0].isKeyword("GRANT") || tokens[0].isKeyword("REVOKE"):
+		obj.parseGrant()
+	}
+	obj.parseDependencies()
+	return obj, nil
+}
+
+// parseObjectKind parses an object kind, e.g. CHANGE STREAM, from the index,
+// and returns the kind and the index of the next token.
+// Only one kind is parsed, so that an object named like a kind, e.g. TABLE Role, is kept as the name.
+func parseObjectKind(tokens []token, i int) (string, int) {
+	for _, words := range namedObjectKinds {
+		if matchKeywords(tokens, i, words) {
+			return strings.Join(words, " "), i + len(words)
+		}
+	}
+	return "", i
+}
+
+// matchKeywords returns true if the tokens from the index are the given keywords.
+func matchKeywords(tokens []token, i int, keywords []string) bool {
+	if i+len(keywords) > len(tokens) {
+		return false
+	}
+	for j, keyword := range keywords {
+		if !tokens[i+j].isKeyword(keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func (obj *ddlStatement) setTable(name []token) {
+	obj.table = tokensText(obj.text, name)
+	obj.tableName = nameValue(name)
+}
+
+// parseTable parses the rest of CREATE TABLE after the table name.
+func (obj *ddlStatement) parseTable(tokens []token) error {
+	if len(tokens) == 0 || !tokens[0].isSymbol("(") {
+		return fmt.Errorf("missing columns: %s", obj.text)
+	}
+	end := findClosingParen(tokens, 0)
+	if end < 0 {
+		return fmt.Errorf("unclosed parenthesis: %s", obj.text)
+	}
+
+	for _, elem := range splitTopLevel(tokens[1:end], ",") {
+		if len(elem) == 0 {
+			continue
+		}
+		e := tableElement{tokens: elem, normalized: normalizeTokens(elem)}
+		switch {
+		case elem[0].isKeyword("CONSTRAINT") && len(elem) > 1:
+			e.name = elem[1].text
+			e.key = strings.ToUpper(elem[1].value())
+			obj.constraints = append(obj.constraints, e)
+		case elem[0].isKeyword("FOREIGN") || elem[0].isKeyword("CHECK"):
+			// Unnamed constraints are identified by their definitions.
+			e.key = e.normalized
+			obj.constraints = append(obj.constraints, e)
+		default:
+			e.name = elem[0].text
+			e.key = strings.ToUpper(elem[0].value())
+			obj.columns = append(obj.columns, e)
+		}
+	}
+
+	// Changes of the primary key, including the types of key columns, and the parent require recreating the table.
+	var primaryKey []string
+	columns := elementsByKey(obj.columns)
+	for _, clause := range splitTopLevel(tokens[end+1:], ",") {
+		switch {
+		case len(clause) > 0 && clause[0].isKeyword("ROW"):
+			obj.rowDeletionPolicy = clause
+		default:
+			if len(clause) > 2 && clause[0].isKeyword("INTERLEAVE") {
+				i := 2
+				if clause[i].isKeyword("PARENT") {
+					i++
+				}
+				parent, _ := parseName(clause, i)
+				obj.parent = tokensText(obj.text, parent)
+			}
+			primaryKey = append(primaryKey, normalizeTokens(clause))
+			if len(clause) > 3 && clause[0].isKeyword("PRIMARY") && clause[2].isSymbol("(") {
+				for _, key := range splitTopLevel(clause[3:len(clause)-1], ",") {
+					if len(key) > 0 {
+						primaryKey = append(primaryKey, columns[strings.ToUpper(key[0].value())].normalized)
+					}
+				}
+			}
+		}
+	}
+	obj.primaryKey = strings.Join(primaryKey, ", ")
+	return nil
+}
+
+// parseGrant parses objects and roles of GRANT or REVOKE, e.g.
+// GRANT SELECT(c1, c2) ON TABLE t1, t2 TO ROLE r1, r2.
+func (obj *ddlStatement) parseGrant() {
+	tokens := obj.tokens
+	if len(tokens) > 1 && tokens[1].isKeyword("ROLE") {
+		// e.g. GRANT ROLE r1 TO ROLE r2
+		obj.dependencies = append(obj.dependencies, parseNameList(tokens, 2)...)
+	}
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.isSymbol("("):
+			depth++
+		case t.isSymbol(")"):
+			depth--
+		case depth == 0 && t.isKeyword("ON"):
+			_, next := parseObjectKind(tokens, i+1)
+			obj.dependencies = append(obj.dependencies, parseNameList(tokens, next)...)
+		case depth == 0 && (t.isKeyword("TO") || t.isKeyword("FROM")) && i+1 < len(tokens) && tokens[i+1].isKeyword("ROLE"):
+			obj.dependencies = append(obj.dependencies, parseNameList(tokens, i+2)...)
+		}
+	}
+}
+
+// parseNameList parses names separated by commas from the index, and returns them without backticks.
+func parseNameList(tokens []token, i int) []string {
+	var names []string
+	for {
+		name, next := parseName(tokens, i)
+		if len(name) == 0 {
+			return names
+		}
+		names = append(names, nameValue(name))
+		if next >= len(tokens) || !tokens[next].isSymbol(",") {
+			return names
+		}
+		i = next + 1
+	}
+}
+
+// fromClauseEnd are keywords which may follow a table name in FROM clause other than an alias.
+var fromClauseEnd = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"GROUP": true, "ORDER": true, "LIMIT": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"ON": true, "USING": true, "HAVING": true, "WINDOW": true, "TABLESAMPLE": true, "FOR": true,
+}
+
+// parseDependencies finds objects which the statement refers to in its body.
+func (obj *ddlStatement) parseDependencies() {
+	tokens := obj.tokens
+	isChangeStream := strings.HasSuffix(obj.kind, "CHANGE STREAM") ||
+		(tokens[0].isKeyword("ALTER") && len(tokens) > 2 && tokens[1].isKeyword("CHANGE"))
+	for i := 1; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isKeyword("REFERENCES"):
+			name, _ := parseName(tokens, i+1)
+			if len(name) > 0 {
+				obj.dependencies = append(obj.dependencies, nameValue(name))
+			}
+		case t.isKeyword("INTERLEAVE") && i+2 < len(tokens) && tokens[i+1].isKeyword("IN"):
+			j := i + 2
+			if tokens[j].isKeyword("PARENT") {
+				j++
+			}
+			name, _ := parseName(tokens, j)
+			if len(name) > 0 {
+				obj.dependencies = append(obj.dependencies, nameValue(name))
+			}
+		case t.isKeyword("SEQUENCE") && i > 1:
+			// e.g. DEFAULT (GET_NEXT_SEQUENCE_VALUE(SEQUENCE s))
+			name, _ := parseName(tokens, i+1)
+			if len(name) > 0 {
+				obj.dependencies = append(obj.dependencies, nameValue(name))
+			}
+		case isChangeStream && t.isKeyword("FOR"):
+			// e.g. FOR t1, t2(c1, c2) or FOR ALL
+			if i+1 < len(tokens) && tokens[i+1].isKeyword("ALL") {
+				obj.allTables = true
+				continue
+			}
+			for j := i + 1; j < len(tokens); {
+				name, next := parseName(tokens, j)
+				if len(name) == 0 {
+					break
+				}
+				obj.dependencies = append(obj.dependencies, nameValue(name))
+				if next < len(tokens) && tokens[next].isSymbol("(") {
+					next = findClosingParen(tokens, next) + 1
+				}
+				if next <= 0 || next >= len(tokens) || !tokens[next].isSymbol(",") {
+					break
+				}
+				j = next + 1
+			}
+		case obj.kind == "VIEW" && (t.isKeyword("FROM") || t.isKeyword("JOIN")):
+			obj.dependencies = append(obj.dependencies, parseFromTables(tokens, i+1)...)
+		}
+	}
+}
+
+// parseFromTables parses table names of FROM clause from the index, e.g. "t1 AS a, t2 b".
+// Subqueries and function calls, e.g. UNNEST(...), are skipped.
+func parseFromTables(tokens []token, i int) []string {
+	var names []string
+	for {
+		name, next := parseName(tokens, i)
+		if len(name) == 0 || (next < len(tokens) && tokens[next].isSymbol("(")) {
+			return names
+		}
+		names = append(names, nameValue(name))
+		if next < len(tokens) && tokens[next].isKeyword("AS") {
+			next += 2
+		} else if next < len(tokens) && tokens[next].kind != tokenSymbol && !fromClauseEnd[strings.ToUpper(tokens[next].text)] {
+			next++
+		}
+		if next >= len(tokens) || !tokens[next].isSymbol(",") {
+			return names
+		}
+		i = next + 1
+	}
+}
+
+// parseDDLs parses DDL statements, and resolves the tables of ALTER INDEX statements.
+func parseDDLs(stmts []string) ([]*ddlStatement, error) {
+	var objs []*ddlStatement
+	indexes := map[string]*ddlStatement{}
+	for _, stmt := range stmts {
+		obj, err := parseDDL(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DDL: %v", err)
+		}
+		if strings.HasSuffix(obj.kind, "INDEX") {
+			indexes[strings.ToUpper(obj.objectName)] = obj
+		}
+		if obj.tokens[0].isKeyword("ALTER") && obj.kind == "" {
+			if kind, i := parseObjectKind(obj.tokens, 1); strings.HasSuffix(kind, "INDEX") {
+				name, _ := parseName(obj.tokens, i)
+				if index, ok := indexes[strings.ToUpper(nameValue(name))]; ok {
+					obj.table = index.table
+					obj.tableName = index.tableName
+				}
+			}
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// definedObjects returns the statements defining objects which other statements can refer to by their names.
+// Indexes and constraints are not included as they are referred to only with their tables.
+func definedObjects(stmts []*ddlStatement) map[string]*ddlStatement {
+	defined := map[string]*ddlStatement{}
+	for _, s := range stmts {
+		switch {
+		case s.kind == "", s.kind == "DATABASE", s.kind == "CONSTRAINT", s.kind == "PROTO BUNDLE", strings.HasSuffix(s.kind, "INDEX"):
+		default:
+			defined[strings.ToUpper(s.objectName)] = s
+		}
+	}
+	return defined
+}
+
+// sortDDLs sorts statements so that every statement comes after the statements defining objects it refers to.
+// The original order is kept as much as possible, by moving the referred statements just before the referring one.
+func sortDDLs(stmts []*ddlStatement) []*ddlStatement {
+	defined := definedObjects(stmts)
+	sorted := make([]*ddlStatement, 0, len(stmts))
+	visited := map[*ddlStatement]bool{}
+	var visit func(s *ddlStatement)
+	visit = func(s *ddlStatement) {
+		// Circular dependencies are left in the original order.
+		if visited[s] {
+			return
+		}
+		visited[s] = true
+		for _, dep := range append([]string{s.tableName}, s.dependencies...) {
+			if def, ok := defined[strings.ToUpper(dep)]; ok {
+				visit(def)
+			}
+		}
+		sorted = append(sorted, s)
+	}
+	for _, s := range stmts {
+		visit(s)
+	}
+	return sorted
+}
+
+// filterDDLs returns statements related to the given tables.
+//
+// Statements belonging to a table, e.g. CREATE TABLE, CREATE INDEX and ALTER TABLE, are included if the table is given.
+// Other statements referring to tables, e.g. views, change streams and grants, are included if all the tables
+// and views they refer to are included. Objects which the included statements refer to, e.g. sequences, schemas
+// and roles, are also included, together with the proto bundle. Statements must be sorted by sortDDLs.
+func filterDDLs(stmts []*ddlStatement, tables map[string]bool) []*ddlStatement {
+	defined := definedObjects(stmts)
+	included := map[*ddlStatement]bool{}
+	for _, s := range stmts {
+		switch {
+		case s.tableName != "":
+			included[s] = tables[s.tableName]
+		case s.kind == "PROTO BUNDLE":
+			// Proto bundles are not referred to by name, so they are always included for PROTO and ENUM columns.
+			included[s] = true
+		case s.allTables:
+		default:
+			refs, ok := 0, true
+			for _, dep := range s.dependencies {
+				def := defined[strings.ToUpper(dep)]
+				switch {
+				case def == nil:
+				case def.kind == "TABLE":
+					refs++
+					ok = ok && tables[def.tableName]
+				case def.kind == "VIEW":
+					refs++
+					ok = ok && included[def]
+				}
+			}
+			included[s] = refs > 0 && ok
+		}
+	}
+
+	var queue []*ddlStatement
+	for s, ok := range included {
+		if ok {
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, dep := range s.dependencies {
+			if def, ok := defined[strings.ToUpper(dep)]; ok && !included[def] && def.kind != "TABLE" && def.kind != "VIEW" {
+				included[def] = true
+				queue = append(queue, def)
+			}
+		}
+	}
+
+	var filtered []*ddlStatement
+	for _, s := range stmts {
+		if included[s] {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
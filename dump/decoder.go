@@ -14,9 +14,10 @@
 // limitations under the License.
 //
 
-package main
+package dump
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math"
@@ -25,7 +26,8 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
-	pb "google.golang.org/genproto/googleapis/spanner/v1"
+	pb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type jsonMessage struct {
@@ -90,6 +92,17 @@ func DecodeColumn(column spanner.GenericColumnValue) (string, error) {
 			for _, v := range vs {
 				decoded = append(decoded, nullFloat64ToString(v))
 			}
+		case pb.TypeCode_FLOAT32:
+			var vs []spanner.NullFloat32
+			if err := column.Decode(&vs); err != nil {
+				return "", err
+			}
+			if vs == nil {
+				return "NULL", nil
+			}
+			for _, v := range vs {
+				decoded = append(decoded, nullFloat32ToString(v))
+			}
 		case pb.TypeCode_INT64:
 			var vs []spanner.NullInt64
 			if err := column.Decode(&vs); err != nil {
@@ -156,8 +169,22 @@ func DecodeColumn(column spanner.GenericColumnValue) (string, error) {
 			for _, v := range vs {
 				decoded = append(decoded, nullJSONToString(v))
 			}
+		case pb.TypeCode_PROTO, pb.TypeCode_ENUM, pb.TypeCode_INTERVAL, pb.TypeCode_UUID:
+			list := column.Value.GetListValue()
+			if list == nil {
+				return "NULL", nil
+			}
+			for _, v := range list.Values {
+				s, err := wireValueToLiteral(column.Type.GetArrayElementType(), v)
+				if err != nil {
+					return "", err
+				}
+				decoded = append(decoded, s)
+			}
 		case pb.TypeCode_STRUCT:
 			return "", errors.New("unexpected error: column has STRUCT data type")
+		default:
+			return "", fmt.Errorf("unsupported type: ARRAY<%v>", column.Type.GetArrayElementType().Code)
 		}
 		return fmt.Sprintf("[%s]", strings.Join(decoded, ", ")), nil
 	case pb.TypeCode_BOOL:
@@ -178,6 +205,12 @@ func DecodeColumn(column spanner.GenericColumnValue) (string, error) {
 			return "", err
 		}
 		return nullFloat64ToString(v), nil
+	case pb.TypeCode_FLOAT32:
+		var v spanner.NullFloat32
+		if err := column.Decode(&v); err != nil {
+			return "", err
+		}
+		return nullFloat32ToString(v), nil
 	case pb.TypeCode_INT64:
 		var v spanner.NullInt64
 		if err := column.Decode(&v); err != nil {
@@ -214,8 +247,10 @@ func DecodeColumn(column spanner.GenericColumnValue) (string, error) {
 			return "", err
 		}
 		return nullJSONToString(v), nil
+	case pb.TypeCode_PROTO, pb.TypeCode_ENUM, pb.TypeCode_INTERVAL, pb.TypeCode_UUID:
+		return wireValueToLiteral(column.Type, column.Value)
 	default:
-		return fmt.Sprintf("%s", column.Value), nil
+		return "", fmt.Errorf("unsupported type: %v", column.Type.Code)
 	}
 }
 
@@ -258,6 +293,22 @@ func nullFloat64ToString(v spanner.NullFloat64) string {
 	}
 }
 
+func nullFloat32ToString(v spanner.NullFloat32) string {
+	switch {
+	case !v.Valid:
+		return "NULL"
+	case math.IsNaN(float64(v.Float32)):
+		return "CAST('nan' AS FLOAT32)"
+	case math.IsInf(float64(v.Float32), 1):
+		return "CAST('inf' AS FLOAT32)"
+	case math.IsInf(float64(v.Float32), -1):
+		return "CAST('-inf' AS FLOAT32)"
+	default:
+		// FLOAT32 has no literal, so the shortest decimal which rounds to the value in FLOAT32 is cast.
+		return fmt.Sprintf("CAST(%s AS FLOAT32)", strconv.FormatFloat(float64(v.Float32), 'g', -1, 32))
+	}
+}
+
 func nullInt64ToString(v spanner.NullInt64) string {
 	if v.Valid {
 		return fmt.Sprintf("%d", v.Int64)
@@ -307,3 +358,37 @@ func nullJSONToString(v spanner.NullJSON) string {
 		return "NULL"
 	}
 }
+
+// wireValueToLiteral converts a value of PROTO, ENUM, INTERVAL or UUID type in the Spanner wire format,
+// which is a string, into a literal. These types have no literals, so string or bytes literals are cast.
+// Qualified names of proto types are enclosed by backticks as in DDL, e.g. CAST(1 AS `example.Genre`).
+func wireValueToLiteral(typ *pb.Type, v *structpb.Value) (string, error) {
+	if _, ok := v.GetKind().(*structpb.Value_NullValue); ok {
+		return "NULL", nil
+	}
+	s, ok := v.GetKind().(*structpb.Value_StringValue)
+	if !ok {
+		return "", fmt.Errorf("unexpected value for %v: %v", typ.Code, v)
+	}
+	switch typ.Code {
+	case pb.TypeCode_PROTO:
+		// Proto messages are serialized and encoded by base64.
+		b, err := base64.StdEncoding.DecodeString(s.StringValue)
+		if err != nil {
+			return "", fmt.Errorf("invalid PROTO value: %v", err)
+		}
+		return fmt.Sprintf("CAST(%s AS `%s`)", nullBytesToString(b), typ.ProtoTypeFqn), nil
+	case pb.TypeCode_ENUM:
+		// Enums are encoded as decimal integers.
+		if _, err := strconv.ParseInt(s.StringValue, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid ENUM value: %v", err)
+		}
+		return fmt.Sprintf("CAST(%s AS `%s`)", s.StringValue, typ.ProtoTypeFqn), nil
+	case pb.TypeCode_INTERVAL:
+		return fmt.Sprintf("CAST(%s AS INTERVAL)", strconv.Quote(s.StringValue)), nil
+	case pb.TypeCode_UUID:
+		return fmt.Sprintf("CAST(%s AS UUID)", strconv.Quote(s.StringValue)), nil
+	default:
+		return "", fmt.Errorf("unexpected type: %v", typ.Code)
+	}
+}
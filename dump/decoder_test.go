@@ -14,7 +14,7 @@
 // limitations under the License.
 //
 
-package main
+package dump
 
 import (
 	"fmt"
@@ -26,6 +26,9 @@ import (
 
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	pb "cloud.google.com/go/spanner/apiv1/spannerpb"
 )
 
 func createRow(t *testing.T, values []interface{}) *spanner.Row {
@@ -122,6 +125,36 @@ func TestDecodeColumn(t *testing.T) {
 			value: -math.SmallestNonzeroFloat64,
 			want:  "-5e-324",
 		},
+		{
+			desc:  "float32",
+			value: float32(1.23),
+			want:  "CAST(1.23 AS FLOAT32)",
+		},
+		{
+			desc:  "math.MaxFloat32",
+			value: float32(math.MaxFloat32),
+			want:  "CAST(3.4028235e+38 AS FLOAT32)",
+		},
+		{
+			desc:  "float32 NaN",
+			value: float32(math.NaN()),
+			want:  "CAST('nan' AS FLOAT32)",
+		},
+		{
+			desc:  "float32 -Inf",
+			value: float32(math.Inf(-1)),
+			want:  "CAST('-inf' AS FLOAT32)",
+		},
+		{
+			desc:  "array float32",
+			value: []float32{1.5, 2},
+			want:  "[CAST(1.5 AS FLOAT32), CAST(2 AS FLOAT32)]",
+		},
+		{
+			desc:  "null float32",
+			value: spanner.NullFloat32{},
+			want:  "NULL",
+		},
 		{
 			desc:  "NaN",
 			value: math.NaN(),
@@ -359,6 +392,109 @@ func TestDecodeColumn(t *testing.T) {
 	}
 }
 
+// TestDecodeColumn_wireValues tests types whose values are given in the Spanner wire format.
+func TestDecodeColumn_wireValues(t *testing.T) {
+	albumType := &pb.Type{Code: pb.TypeCode_PROTO, ProtoTypeFqn: "example.Album"}
+	genreType := &pb.Type{Code: pb.TypeCode_ENUM, ProtoTypeFqn: "example.Genre"}
+	intervalType := &pb.Type{Code: pb.TypeCode_INTERVAL}
+	uuidType := &pb.Type{Code: pb.TypeCode_UUID}
+	arrayOf := func(typ *pb.Type) *pb.Type {
+		return &pb.Type{Code: pb.TypeCode_ARRAY, ArrayElementType: typ}
+	}
+	list := func(values ...*structpb.Value) *structpb.Value {
+		return structpb.NewListValue(&structpb.ListValue{Values: values})
+	}
+
+	for _, tt := range []struct {
+		desc  string
+		typ   *pb.Type
+		value *structpb.Value
+		want  string
+	}{
+		{
+			desc:  "proto",
+			typ:   albumType,
+			value: structpb.NewStringValue("CgNmb28="),
+			want:  "CAST(b\"\\x0a\\x03\\x66\\x6f\\x6f\" AS `example.Album`)",
+		},
+		{
+			desc:  "null proto",
+			typ:   albumType,
+			value: structpb.NewNullValue(),
+			want:  "NULL",
+		},
+		{
+			desc:  "enum",
+			typ:   genreType,
+			value: structpb.NewStringValue("3"),
+			want:  "CAST(3 AS `example.Genre`)",
+		},
+		{
+			desc:  "interval",
+			typ:   intervalType,
+			value: structpb.NewStringValue("P1Y2M3DT4H5M6.5S"),
+			want:  `CAST("P1Y2M3DT4H5M6.5S" AS INTERVAL)`,
+		},
+		{
+			desc:  "uuid",
+			typ:   uuidType,
+			value: structpb.NewStringValue("d1a0ce61-b9dd-4b2a-9a26-8e8e8b8b2a11"),
+			want:  `CAST("d1a0ce61-b9dd-4b2a-9a26-8e8e8b8b2a11" AS UUID)`,
+		},
+		{
+			desc:  "array proto",
+			typ:   arrayOf(albumType),
+			value: list(structpb.NewStringValue(""), structpb.NewNullValue()),
+			want:  "[CAST(b\"\" AS `example.Album`), NULL]",
+		},
+		{
+			desc:  "array enum",
+			typ:   arrayOf(genreType),
+			value: list(structpb.NewStringValue("1"), structpb.NewStringValue("-2")),
+			want:  "[CAST(1 AS `example.Genre`), CAST(-2 AS `example.Genre`)]",
+		},
+		{
+			desc:  "array interval",
+			typ:   arrayOf(intervalType),
+			value: list(structpb.NewStringValue("P1D")),
+			want:  `[CAST("P1D" AS INTERVAL)]`,
+		},
+		{
+			desc:  "empty array uuid",
+			typ:   arrayOf(uuidType),
+			value: list(),
+			want:  "[]",
+		},
+		{
+			desc:  "null array uuid",
+			typ:   arrayOf(uuidType),
+			value: structpb.NewNullValue(),
+			want:  "NULL",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := DecodeColumn(spanner.GenericColumnValue{Type: tt.typ, Value: tt.value})
+			if err != nil {
+				t.Error(err)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeColumn(%v) = %q, want = %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeColumn_unsupportedType(t *testing.T) {
+	for _, typ := range []*pb.Type{
+		{Code: pb.TypeCode_TYPE_CODE_UNSPECIFIED},
+		{Code: pb.TypeCode_ARRAY, ArrayElementType: &pb.Type{Code: pb.TypeCode_TYPE_CODE_UNSPECIFIED}},
+	} {
+		if got, err := DecodeColumn(spanner.GenericColumnValue{Type: typ, Value: structpb.NewStringValue("x")}); err == nil {
+			t.Errorf("DecodeColumn() of %v = %q, want error", typ, got)
+		}
+	}
+}
+
 func TestDecodeColumn_roundtripFloat64(t *testing.T) {
 	for _, tt := range []float64{
 		math.MaxFloat64,
@@ -0,0 +1,495 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+
+	pb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// DiffKind is a kind of difference of a row.
+type DiffKind int
+
+const (
+	// RowInserted means the row exists only in the target.
+	RowInserted DiffKind = iota + 1
+	// RowDeleted means the row exists only in the source.
+	RowDeleted
+	// RowChanged means the row exists in both, but some of the values differ.
+	RowChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case RowInserted:
+		return "inserted"
+	case RowDeleted:
+		return "deleted"
+	case RowChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// RowDiff is a difference of a row between two databases or snapshots.
+// Values are decoded by DecodeColumn, so they are SQL literals.
+type RowDiff struct {
+	Table *Table
+	Kind  DiffKind
+	// Key is the primary key of the row, like "(1, \"foo\")".
+	Key string
+	// Old and New are the values of the row in the source and in the target respectively, in the order of Table.Columns.
+	// Old is nil for an inserted row, and New is nil for a deleted row.
+	Old []string
+	New []string
+	// ChangedColumns are the names of columns whose values differ in a changed row.
+	ChangedColumns []string
+}
+
+// String returns a human readable representation of the difference.
+func (r *RowDiff) String() string {
+	switch r.Kind {
+	case RowInserted:
+		return fmt.Sprintf("+ %s %s", r.Table.Name, r.Key)
+	case RowDeleted:
+		return fmt.Sprintf("- %s %s", r.Table.Name, r.Key)
+	default:
+		var changes []string
+		for _, c := range r.ChangedColumns {
+			i := columnIndex(r.Table, c)
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", c, r.Old[i], r.New[i]))
+		}
+		return fmt.Sprintf("~ %s %s %s", r.Table.Name, r.Key, strings.Join(changes, ", "))
+	}
+}
+
+// DML returns a DML statement which applies the difference to the source.
+func (r *RowDiff) DML() string {
+	switch r.Kind {
+	case RowInserted:
+		return fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s);", r.Table.Name, r.Table.quotedColumnList(), strings.Join(r.New, ", "))
+	case RowDeleted:
+		return fmt.Sprintf("DELETE FROM `%s` WHERE %s;", r.Table.Name, r.keyCondition(r.Old))
+	default:
+		var sets []string
+		for _, c := range r.ChangedColumns {
+			sets = append(sets, fmt.Sprintf("`%s` = %s", c, r.New[columnIndex(r.Table, c)]))
+		}
+		return fmt.Sprintf("UPDATE `%s` SET %s WHERE %s;", r.Table.Name, strings.Join(sets, ", "), r.keyCondition(r.Old))
+	}
+}
+
+func (r *RowDiff) keyCondition(values []string) string {
+	var conds []string
+	for _, pk := range r.Table.PrimaryKeys {
+		v := values[columnIndex(r.Table, pk)]
+		if v == "NULL" {
+			conds = append(conds, fmt.Sprintf("`%s` IS NULL", pk))
+		} else {
+			conds = append(conds, fmt.Sprintf("`%s` = %s", pk, v))
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func columnIndex(table *Table, column string) int {
+	for i, c := range table.Columns {
+		if c.Name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Diff compares tables of two databases or snapshots, and calls f with each differing row.
+//
+// The source is the database of from, and the target is the database of to, which are read at
+// their Options.Timestamp, Options.Staleness or Options.MaxStaleness. Tables are selected by Options.Tables of from,
+// and read as they are dumped with Options.DatabaseRole and Options.UnsupportedTypes of each dumper.
+// They must have the same columns of the same types and primary keys in both databases.
+// Rows are read in the primary key order, so differences are also found in that order for each table.
+func Diff(ctx context.Context, from, to *Dumper, f func(*RowDiff) error) error {
+	fromTxn, err := from.readOnlyTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer fromTxn.Close()
+	toTxn, err := to.readOnlyTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer toTxn.Close()
+
+	fromTables, err := from.diffTables(ctx, fromTxn, from.tables)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, t := range fromTables {
+		names[t.Name] = true
+	}
+	toTables, err := to.diffTables(ctx, toTxn, names)
+	if err != nil {
+		return err
+	}
+	toTablesByName := map[string]*Table{}
+	for _, t := range toTables {
+		toTablesByName[t.Name] = t
+	}
+
+	for _, t := range fromTables {
+		toTable, ok := toTablesByName[t.Name]
+		if !ok {
+			return fmt.Errorf("table %s doesn't exist in the target", t.Name)
+		}
+		if err := compareTableSchemas(t, toTable); err != nil {
+			return fmt.Errorf("table %s has a different schema in the target: %v", t.Name, err)
+		}
+		if len(t.PrimaryKeys) == 0 {
+			return fmt.Errorf("table %s has no primary keys", t.Name)
+		}
+		if err := diffTable(ctx, t, fromTxn, toTxn, from.queryOptions(t.Name+"/diff"), to.queryOptions(t.Name+"/diff"), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffTables returns the given tables, or all tables if none are given, as they are dumped.
+func (d *Dumper) diffTables(ctx context.Context, txn *spanner.ReadOnlyTransaction, names map[string]bool) ([]*Table, error) {
+	iter, err := d.fetchTables(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	var tables []*Table
+	if err := iter.Do(func(t *Table) error {
+		if len(names) == 0 || names[t.Name] {
+			tables = append(tables, t)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return d.prepareTables(ctx, txn, tables, d.unsupportedTypes)
+}
+
+// compareTableSchemas returns an error describing the first difference of columns, their types or primary keys.
+// Lengths of STRING and BYTES are ignored, as they don't change the values.
+func compareTableSchemas(from, to *Table) error {
+	if from.quotedColumnList() != to.quotedColumnList() {
+		return fmt.Errorf("columns (%s) in the source, (%s) in the target", from.quotedColumnList(), to.quotedColumnList())
+	}
+	for i, c := range from.Columns {
+		toColumn := to.Columns[i]
+		if columnTypeWithoutLength(c.Type) != columnTypeWithoutLength(toColumn.Type) {
+			return fmt.Errorf("column %s is %s in the source, %s in the target", c.Name, c.Type, toColumn.Type)
+		}
+		if c.null != toColumn.null {
+			return fmt.Errorf("column %s is read as NULL only in one of them", c.Name)
+		}
+	}
+	if from.quotedPrimaryKeyList() != to.quotedPrimaryKeyList() {
+		return fmt.Errorf("primary keys (%s) in the source, (%s) in the target", from.quotedPrimaryKeyList(), to.quotedPrimaryKeyList())
+	}
+	return nil
+}
+
+// columnTypeWithoutLength returns the column type without lengths, e.g. "ARRAY<STRING>" for "ARRAY<STRING(MAX)>".
+func columnTypeWithoutLength(typ string) string {
+	for {
+		open := strings.Index(typ, "(")
+		if open < 0 {
+			return typ
+		}
+		end := strings.Index(typ[open:], ")")
+		if end < 0 {
+			return typ
+		}
+		typ = typ[:open] + typ[open+end+1:]
+	}
+}
+
+// keyedRow is a row read from a table with its decoded values.
+type keyedRow struct {
+	values  []spanner.GenericColumnValue
+	decoded []string
+}
+
+// keyedRowIterator reads rows of a table in the primary key order.
+type keyedRowIterator struct {
+	iter *spanner.RowIterator
+}
+
+// next returns the next row, or nil if there are no more rows.
+func (i *keyedRowIterator) next() (*keyedRow, error) {
+	row, err := i.iter.Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &keyedRow{
+		values:  make([]spanner.GenericColumnValue, row.Size()),
+		decoded: make([]string, row.Size()),
+	}
+	for j := range r.values {
+		if err := row.Column(j, &r.values[j]); err != nil {
+			return nil, err
+		}
+		if r.decoded[j], err = DecodeColumn(r.values[j]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// diffTable compares rows of the table by merging two row streams sorted by the primary key.
+func diffTable(ctx context.Context, table *Table, fromTxn, toTxn *spanner.ReadOnlyTransaction, fromOpts, toOpts spanner.QueryOptions, f func(*RowDiff) error) error {
+	fromIter := &keyedRowIterator{queryTable(ctx, table, fromTxn, true, fromOpts)}
+	defer fromIter.iter.Stop()
+	toIter := &keyedRowIterator{queryTable(ctx, table, toTxn, true, toOpts)}
+	defer toIter.iter.Stop()
+
+	keyIndex := primaryKeyIndex(table)
+	oldRow, err := fromIter.next()
+	if err != nil {
+		return err
+	}
+	newRow, err := toIter.next()
+	if err != nil {
+		return err
+	}
+	for oldRow != nil || newRow != nil {
+		cmp := 0
+		switch {
+		case oldRow == nil:
+			cmp = 1
+		case newRow == nil:
+			cmp = -1
+		default:
+			if cmp, err = compareKeys(oldRow.values, newRow.values, keyIndex); err != nil {
+				return fmt.Errorf("failed to compare primary keys of table %s: %v", table.Name, err)
+			}
+		}
+
+		switch {
+		case cmp < 0:
+			if err := f(&RowDiff{Table: table, Kind: RowDeleted, Key: primaryKeyString(oldRow.decoded, keyIndex), Old: oldRow.decoded}); err != nil {
+				return err
+			}
+			if oldRow, err = fromIter.next(); err != nil {
+				return err
+			}
+		case cmp > 0:
+			if err := f(&RowDiff{Table: table, Kind: RowInserted, Key: primaryKeyString(newRow.decoded, keyIndex), New: newRow.decoded}); err != nil {
+				return err
+			}
+			if newRow, err = toIter.next(); err != nil {
+				return err
+			}
+		default:
+			var changed []string
+			for i, c := range table.Columns {
+				if oldRow.decoded[i] != newRow.decoded[i] {
+					changed = append(changed, c.Name)
+				}
+			}
+			if len(changed) > 0 {
+				if err := f(&RowDiff{Table: table, Kind: RowChanged, Key: primaryKeyString(oldRow.decoded, keyIndex), Old: oldRow.decoded, New: newRow.decoded, ChangedColumns: changed}); err != nil {
+					return err
+				}
+			}
+			if oldRow, err = fromIter.next(); err != nil {
+				return err
+			}
+			if newRow, err = toIter.next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareKeys compares primary keys of two rows in the same order as ORDER BY of Spanner.
+func compareKeys(a, b []spanner.GenericColumnValue, keyIndex []int) (int, error) {
+	for _, i := range keyIndex {
+		cmp, err := compareColumnValues(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+// compareColumnValues compares two values of the same type. NULL is smaller than any other values.
+func compareColumnValues(a, b spanner.GenericColumnValue) (int, error) {
+	_, aNull := a.Value.GetKind().(*structpb.Value_NullValue)
+	_, bNull := b.Value.GetKind().(*structpb.Value_NullValue)
+	switch {
+	case aNull && bNull:
+		return 0, nil
+	case aNull:
+		return -1, nil
+	case bNull:
+		return 1, nil
+	}
+
+	switch a.Type.Code {
+	case pb.TypeCode_BOOL:
+		var x, y bool
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return compareBool(x, y), nil
+	case pb.TypeCode_INT64:
+		var x, y int64
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return compareInt64(x, y), nil
+	case pb.TypeCode_FLOAT64:
+		var x, y float64
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return compareFloat64(x, y), nil
+	case pb.TypeCode_FLOAT32:
+		var x, y float32
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return compareFloat64(float64(x), float64(y)), nil
+	case pb.TypeCode_ENUM:
+		// Enums are ordered by their numbers, which are encoded as decimal strings.
+		x, err := strconv.ParseInt(a.Value.GetStringValue(), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ENUM value: %v", err)
+		}
+		y, err := strconv.ParseInt(b.Value.GetStringValue(), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ENUM value: %v", err)
+		}
+		return compareInt64(x, y), nil
+	case pb.TypeCode_UUID:
+		// UUIDs are encoded in the canonical lowercase form, which is ordered in the same way as their bytes.
+		return strings.Compare(a.Value.GetStringValue(), b.Value.GetStringValue()), nil
+	case pb.TypeCode_STRING:
+		// Comparing UTF-8 bytes is the same as comparing Unicode code points.
+		var x, y string
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return strings.Compare(x, y), nil
+	case pb.TypeCode_BYTES:
+		var x, y []byte
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return bytes.Compare(x, y), nil
+	case pb.TypeCode_TIMESTAMP:
+		var x, y spanner.NullTime
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		// UnixNano is undefined out of years 1678-2262, but Spanner allows timestamps from 0001 to 9999.
+		return x.Time.Compare(y.Time), nil
+	case pb.TypeCode_DATE:
+		var x, y spanner.NullDate
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		switch {
+		case x.Date.Before(y.Date):
+			return -1, nil
+		case x.Date.After(y.Date):
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case pb.TypeCode_NUMERIC:
+		var x, y spanner.NullNumeric
+		if err := decodeBoth(a, b, &x, &y); err != nil {
+			return 0, err
+		}
+		return x.Numeric.Cmp(&y.Numeric), nil
+	default:
+		return 0, fmt.Errorf("unsupported type for primary key: %v", a.Type.Code)
+	}
+}
+
+func decodeBoth(a, b spanner.GenericColumnValue, x, y interface{}) error {
+	if err := a.Decode(x); err != nil {
+		return err
+	}
+	return b.Decode(y)
+}
+
+func compareBool(x, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case !x:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareFloat64 compares floats in the same order as Spanner, where NaN is smaller than any other values.
+func compareFloat64(x, y float64) int {
+	switch {
+	case math.IsNaN(x) && math.IsNaN(y):
+		return 0
+	case math.IsNaN(x):
+		return -1
+	case math.IsNaN(y):
+		return 1
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,209 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/cloudspannerecosystem/spanner-dump/internal/fakespanner"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestCompareColumnValues(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		a, b interface{}
+		want int
+	}{
+		{desc: "int64 less", a: int64(1), b: int64(2), want: -1},
+		{desc: "int64 equal", a: int64(2), b: int64(2), want: 0},
+		{desc: "int64 negative", a: int64(-10), b: int64(2), want: -1},
+		{desc: "int64 NULL is smallest", a: spanner.NullInt64{}, b: int64(math.MinInt64), want: -1},
+		{desc: "int64 both NULL", a: spanner.NullInt64{}, b: spanner.NullInt64{}, want: 0},
+		{desc: "string", a: "b", b: "a", want: 1},
+		{desc: "string by code point", a: "Z", b: "a", want: -1},
+		{desc: "bytes", a: []byte{0x01}, b: []byte{0x01, 0x00}, want: -1},
+		{desc: "bool", a: true, b: false, want: 1},
+		{desc: "float64 NaN is smallest", a: math.NaN(), b: math.Inf(-1), want: -1},
+		{desc: "float32", a: float32(1.5), b: float32(-2), want: 1},
+		{desc: "uuid", a: uuid.MustParse("00000000-0000-0000-0000-00000000000a"), b: uuid.MustParse("00000000-0000-0000-0000-000000000100"), want: -1},
+		{desc: "date", a: civil.Date{Year: 2020, Month: 1, Day: 2}, b: civil.Date{Year: 2020, Month: 1, Day: 1}, want: 1},
+		{desc: "timestamp", a: mustParseTimeString(t, "2020-01-01T00:00:00Z"), b: mustParseTimeString(t, "2020-01-01T00:00:01Z"), want: -1},
+		{desc: "timestamp in year 0001 and 9999", a: mustParseTimeString(t, "0001-01-01T00:00:00Z"), b: mustParseTimeString(t, "9999-12-31T23:59:59.999999999Z"), want: -1},
+		{desc: "timestamp in year 9999 and 2020", a: mustParseTimeString(t, "9999-12-31T23:59:59Z"), b: mustParseTimeString(t, "2020-01-01T00:00:00Z"), want: 1},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := compareColumnValues(createColumnValue(t, tt.a), createColumnValue(t, tt.b))
+			if err != nil {
+				t.Fatalf("compareColumnValues() failed unexpectedly: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("compareColumnValues(%v, %v) = %d, want = %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffWithFakeServer(t *testing.T) {
+	server := newFakeServer(t)
+
+	targetDatabasePath := "projects/fake-project/instances/fake-instance/databases/target"
+	t1 := fakeTables[0]
+	// Row 1 is changed, row 2 is deleted, and row 4 is inserted.
+	server.PutDatabaseStatementResult(targetDatabasePath, "SELECT `Id`, `Name`, `Tags` FROM `t1` ORDER BY `Id`", fakespanner.NewResultSet(t1.columns,
+		[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("changed"), fakespanner.StringListValue("a")},
+		t1.rows[2],
+		[]*structpb.Value{fakespanner.IntValue(4), fakespanner.NullValue(), fakespanner.NullValue()},
+	))
+
+	from := newFakeDumper(t, server, Options{Tables: []string{"t1", "t2"}})
+	client, adminClient := newFakeClients(t, server, targetDatabasePath)
+	to, err := NewDumperWithClients(context.Background(), Options{}, client, adminClient)
+	if err != nil {
+		t.Fatalf("failed to create dumper: %v", err)
+	}
+
+	var got, gotDML []string
+	if err := Diff(context.Background(), from, to, func(d *RowDiff) error {
+		got = append(got, d.String())
+		gotDML = append(gotDML, d.DML())
+		return nil
+	}); err != nil {
+		t.Fatalf("Diff() failed unexpectedly: %v", err)
+	}
+
+	want := []string{
+		"~ t1 (1) Name: \"foo\" -> \"changed\", Tags: [\"a\", \"b\"] -> [\"a\"]",
+		"- t1 (2)",
+		"+ t1 (4)",
+	}
+	if !equalStringSlice(got, want) {
+		t.Errorf("Diff() = %q, want = %q", got, want)
+	}
+
+	wantDML := []string{
+		"UPDATE `t1` SET `Name` = \"changed\", `Tags` = [\"a\"] WHERE `Id` = 1;",
+		"DELETE FROM `t1` WHERE `Id` = 2;",
+		"INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (4, NULL, NULL);",
+	}
+	if !equalStringSlice(gotDML, wantDML) {
+		t.Errorf("DML() = %q, want = %q", gotDML, wantDML)
+	}
+}
+
+func TestDiffWithFakeServer_Schemas(t *testing.T) {
+	server := newFakeServer(t)
+	fromDatabasePath := "projects/fake-project/instances/fake-instance/databases/diff-from"
+	toDatabasePath := "projects/fake-project/instances/fake-instance/databases/diff-to"
+	columns := []*sppb.StructType_Field{
+		fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		fakespanner.Field("Shape", fakespanner.Type(sppb.TypeCode_STRING)),
+		fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+	}
+	putFakeTables(server, fromDatabasePath, []fakeTable{{
+		name:        "t7",
+		columns:     columns,
+		types:       []string{"INT64", "GEOGRAPHY", "STRING(MAX)"},
+		primaryKeys: []string{"Id"},
+	}})
+	// Rows of the query with the unsupported column skipped.
+	skipped := []*sppb.StructType_Field{columns[0], columns[2]}
+	server.PutDatabaseStatementResult(fromDatabasePath, "SELECT `Id`, `Name` FROM `t7` ORDER BY `Id`", fakespanner.NewResultSet(skipped,
+		[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("foo")}))
+	server.PutDatabaseStatementResult(toDatabasePath, "SELECT `Id`, `Name` FROM `t7` ORDER BY `Id`", fakespanner.NewResultSet(skipped,
+		[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("bar")}))
+
+	for _, tt := range []struct {
+		desc    string
+		toTypes []string
+		opts    Options
+		want    []string
+		wantErr string
+	}{
+		{
+			desc:    "unsupported types are skipped",
+			toTypes: []string{"INT64", "GEOGRAPHY", "STRING(MAX)"},
+			opts:    Options{UnsupportedTypes: UnsupportedTypesSkip},
+			want:    []string{"~ t7 (1) Name: \"foo\" -> \"bar\""},
+		},
+		{
+			desc:    "lengths are ignored",
+			toTypes: []string{"INT64", "GEOGRAPHY", "STRING(10)"},
+			opts:    Options{UnsupportedTypes: UnsupportedTypesSkip},
+			want:    []string{"~ t7 (1) Name: \"foo\" -> \"bar\""},
+		},
+		{
+			desc:    "unsupported types are errors by default",
+			toTypes: []string{"INT64", "GEOGRAPHY", "STRING(MAX)"},
+			wantErr: "unsupported column types: t7.Shape (GEOGRAPHY)",
+		},
+		{
+			desc:    "changed type",
+			toTypes: []string{"INT64", "GEOGRAPHY", "INT64"},
+			opts:    Options{UnsupportedTypes: UnsupportedTypesSkip},
+			wantErr: "table t7 has a different schema in the target: column Name is STRING(MAX) in the source, INT64 in the target",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			putFakeTables(server, toDatabasePath, []fakeTable{{
+				name:        "t7",
+				columns:     columns,
+				types:       tt.toTypes,
+				primaryKeys: []string{"Id"},
+			}})
+			server.PutDatabaseStatementResult(toDatabasePath, "SELECT `Id`, `Name` FROM `t7` ORDER BY `Id`", fakespanner.NewResultSet(skipped,
+				[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("bar")}))
+
+			var dumpers []*Dumper
+			for _, database := range []string{fromDatabasePath, toDatabasePath} {
+				client, adminClient := newFakeClients(t, server, database)
+				dumper, err := NewDumperWithClients(context.Background(), tt.opts, client, adminClient)
+				if err != nil {
+					t.Fatalf("failed to create dumper: %v", err)
+				}
+				dumpers = append(dumpers, dumper)
+			}
+
+			var got []string
+			err := Diff(context.Background(), dumpers[0], dumpers[1], func(d *RowDiff) error {
+				got = append(got, d.String())
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Diff() = %v, want error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Diff() failed unexpectedly: %v", err)
+			}
+			if !equalStringSlice(got, tt.want) {
+				t.Errorf("Diff() = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"fmt"
+	"strings"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// ParseDirectedReadOptions parses directed read options which include replicas in the order of preference,
+// e.g. "region:us-east1,type:READ_ONLY" or "region:us-east1;region:us-west1".
+//
+// Replica selections are separated by semicolons, and each of them consists of comma-separated key-value pairs:
+// "region" is the location of replicas, and "type" is the replica type, READ_ONLY or READ_WRITE.
+func ParseDirectedReadOptions(s string) (*sppb.DirectedReadOptions, error) {
+	var selections []*sppb.DirectedReadOptions_ReplicaSelection
+	for _, sel := range strings.Split(s, ";") {
+		if strings.TrimSpace(sel) == "" {
+			return nil, fmt.Errorf("empty replica selection in directed read options: %q", s)
+		}
+		selection := &sppb.DirectedReadOptions_ReplicaSelection{}
+		for _, kv := range strings.Split(sel, ",") {
+			i := strings.Index(kv, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid replica selection %q, must be like \"region:us-east1,type:READ_ONLY\"", sel)
+			}
+			key, value := strings.ToLower(strings.TrimSpace(kv[:i])), strings.TrimSpace(kv[i+1:])
+			switch key {
+			case "region":
+				selection.Location = value
+			case "type":
+				typ, ok := sppb.DirectedReadOptions_ReplicaSelection_Type_value[strings.ToUpper(value)]
+				if !ok || typ == int32(sppb.DirectedReadOptions_ReplicaSelection_TYPE_UNSPECIFIED) {
+					return nil, fmt.Errorf("unknown replica type: %q, must be READ_ONLY or READ_WRITE", value)
+				}
+				selection.Type = sppb.DirectedReadOptions_ReplicaSelection_Type(typ)
+			default:
+				return nil, fmt.Errorf("unknown key of replica selection: %q, must be region or type", key)
+			}
+		}
+		selections = append(selections, selection)
+	}
+	return &sppb.DirectedReadOptions{
+		Replicas: &sppb.DirectedReadOptions_IncludeReplicas_{
+			IncludeReplicas: &sppb.DirectedReadOptions_IncludeReplicas{ReplicaSelections: selections},
+		},
+	}, nil
+}
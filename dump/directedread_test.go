@@ -0,0 +1,102 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestParseDirectedReadOptions(t *testing.T) {
+	include := func(selections ...*sppb.DirectedReadOptions_ReplicaSelection) *sppb.DirectedReadOptions {
+		return &sppb.DirectedReadOptions{
+			Replicas: &sppb.DirectedReadOptions_IncludeReplicas_{
+				IncludeReplicas: &sppb.DirectedReadOptions_IncludeReplicas{ReplicaSelections: selections},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		desc    string
+		s       string
+		want    *sppb.DirectedReadOptions
+		wantErr bool
+	}{
+		{
+			desc: "region and type",
+			s:    "region:us-east1,type:READ_ONLY",
+			want: include(&sppb.DirectedReadOptions_ReplicaSelection{Location: "us-east1", Type: sppb.DirectedReadOptions_ReplicaSelection_READ_ONLY}),
+		},
+		{
+			desc: "type only in lower case",
+			s:    "type:read_write",
+			want: include(&sppb.DirectedReadOptions_ReplicaSelection{Type: sppb.DirectedReadOptions_ReplicaSelection_READ_WRITE}),
+		},
+		{
+			desc: "multiple selections",
+			s:    "region:us-east1, type:READ_ONLY; region:us-west1",
+			want: include(
+				&sppb.DirectedReadOptions_ReplicaSelection{Location: "us-east1", Type: sppb.DirectedReadOptions_ReplicaSelection_READ_ONLY},
+				&sppb.DirectedReadOptions_ReplicaSelection{Location: "us-west1"},
+			),
+		},
+		{
+			desc:    "empty",
+			s:       "",
+			wantErr: true,
+		},
+		{
+			desc:    "empty selection",
+			s:       "region:us-east1;",
+			wantErr: true,
+		},
+		{
+			desc:    "missing colon",
+			s:       "us-east1",
+			wantErr: true,
+		},
+		{
+			desc:    "unknown key",
+			s:       "zone:us-east1-b",
+			wantErr: true,
+		},
+		{
+			desc:    "unknown type",
+			s:       "type:WITNESS",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := ParseDirectedReadOptions(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDirectedReadOptions(%q) = %v, want error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDirectedReadOptions(%q) failed: %v", tt.s, err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("ParseDirectedReadOptions(%q) = %v, want = %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
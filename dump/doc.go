@@ -0,0 +1,52 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+/*
+Package dump exports a Cloud Spanner database in text format.
+
+The exported text consists of DDL statements and INSERT statements, which can
+be imported to Cloud Spanner with spanner-cli.
+
+A Dumper is created with NewDumper and must be cleaned up by Cleanup:
+
+	dumper, err := dump.NewDumper(ctx, dump.Options{
+		Project:  "my-project",
+		Instance: "my-instance",
+		Database: "my-database",
+		Out:      os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+	defer dumper.Cleanup()
+
+	if err := dumper.DumpDDLs(ctx); err != nil {
+		return err
+	}
+	if err := dumper.DumpTables(ctx); err != nil {
+		return err
+	}
+
+NewDumperWithClients creates a Dumper using clients created by the caller,
+which are not closed by Cleanup.
+
+Table records are written by a RowEncoder. SQL, CSV and JSON Lines encoders are
+built in, and other output formats can be added by RegisterEncoder.
+
+FetchTables, DecodeRow and BufferedWriter are the building blocks used by
+Dumper, and can be used separately to implement a custom dump.
+*/
+package dump
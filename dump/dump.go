@@ -0,0 +1,922 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// This is an ad hoc value, but considering mutations limit (20,000),
+// 100 rows/statement would be safe in most cases.
+// https://cloud.google.com/spanner/quotas#limits_for_creating_reading_updating_and_deleting_data
+const defaultBulkSize = 100
+
+// DefaultRequestTag is the default prefix of request tags of queries. See Options.RequestTag.
+const DefaultRequestTag = "spanner-dump"
+
+// DefaultRetryBackoff is the default delay before the first retry of a query of a table. See Options.RetryBackoff.
+const DefaultRetryBackoff = time.Second
+
+// maxRetryBackoff is the upper limit of the delay between retries, which is doubled for each retry.
+const maxRetryBackoff = time.Minute
+
+// cloudPlatformScope is the OAuth scope of an impersonated service account, which covers both Spanner API
+// and Database Admin API.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Ways to handle columns of types which can't be dumped. See Options.UnsupportedTypes.
+const (
+	UnsupportedTypesError = "error" // fail before reading any data
+	UnsupportedTypesSkip  = "skip"  // omit the columns
+	UnsupportedTypesNull  = "null"  // dump NULL instead of the values
+)
+
+// Options configures a Dumper.
+type Options struct {
+	// Project, Instance and Database identify the database to dump.
+	// They are required by NewDumper, and ignored by NewDumperWithClients.
+	Project  string
+	Instance string
+	Database string
+
+	// Out is the destination of the dump. If nil, os.Stdout is used.
+	Out io.Writer
+
+	// Tables limits the dump to the given tables. Table names may be enclosed by backticks.
+	// If empty, all tables in the database are dumped.
+	//
+	// DDLs are also limited to the given tables, their indexes, and views, change streams and grants
+	// which refer only to the given tables, together with objects they depend on, e.g. sequences.
+	Tables []string
+
+	// Objects limits DDLs to the given object types, e.g. ObjectTables and ObjectViews. See ObjectTypes.
+	// If empty, DDLs of all object types are dumped.
+	Objects []string
+
+	// Timestamp is the read timestamp of the database snapshot.
+	// If nil, a strong read is performed unless Staleness or MaxStaleness is set.
+	Timestamp *time.Time
+
+	// Staleness reads the database snapshot at the exact staleness, e.g. 15 seconds before the start of DumpTables.
+	Staleness time.Duration
+
+	// MaxStaleness reads the database snapshot at a timestamp within the bounded staleness, chosen by Cloud Spanner
+	// to avoid waiting for the latest data. The timestamp is resolved by a query before reading tables,
+	// so that all the tables are read at the same timestamp.
+	//
+	// Only one of Timestamp, Staleness and MaxStaleness can be set. The read timestamp of Timestamp and Staleness
+	// is checked against the earliest version time of the database, which is limited by version_retention_period.
+	MaxStaleness time.Duration
+
+	// BulkSize is the number of rows in a single INSERT statement.
+	// If zero, a default value is used.
+	BulkSize uint
+
+	// Format is the name of the registered output format for table records. See RegisterEncoder.
+	// If empty, FormatSQL is used. DDLs are always written in SQL.
+	Format string
+
+	// PendingCommitTimestamp writes values of commit timestamp columns as PENDING_COMMIT_TIMESTAMP()
+	// for formats which support it. See EncoderOptions.
+	PendingCommitTimestamp bool
+
+	// OmitDefaultColumns omits columns which have default values from table records. See EncoderOptions.
+	OmitDefaultColumns bool
+
+	// CSVNull is the field written for NULL in CSV. See EncoderOptions.
+	CSVNull string
+
+	// UnsupportedTypes decides how columns of types which can't be dumped are handled:
+	// UnsupportedTypesError, UnsupportedTypesSkip or UnsupportedTypesNull.
+	// Column types of the tables are checked before reading any data.
+	// If empty, UnsupportedTypesError is used. Primary key columns are never skipped or nulled.
+	UnsupportedTypes string
+
+	// Progress is the destination of progress reports of DumpTables, e.g. os.Stderr. If nil, progress is not reported.
+	// Rows of the tables are counted before dumping them to estimate the remaining time.
+	Progress io.Writer
+
+	// BytesWritten returns the number of bytes written by Encoder, which is reported as progress.
+	// It's used only if Encoder is set, as bytes written to Out are counted otherwise.
+	BytesWritten func() int64
+
+	// RequestTag is the prefix of request tags of queries, which distinguish the queries in query statistics.
+	// Queries of a table are tagged like "<prefix>/<table>", and the query of table schemas is tagged "<prefix>/fetch-tables".
+	// If empty, DefaultRequestTag is used.
+	RequestTag string
+
+	// Priority is the priority of queries. If PRIORITY_UNSPECIFIED, PRIORITY_LOW is used.
+	Priority sppb.RequestOptions_Priority
+
+	// DataBoost reads tables by partitioned queries with Data Boost, which run on independent compute resources
+	// without impacting the instance. Queries of table schemas and row counts are not partitioned.
+	// Query statistics are not collected with Data Boost.
+	DataBoost bool
+
+	// MaxRetries is the maximum number of retries of the query of a table which fails with a transient error,
+	// e.g. an aborted stream or DEADLINE_EXCEEDED. If it's set, tables are read in primary key order, and a retry
+	// resumes the query after the primary key of the last written row in the same snapshot, so rows are neither
+	// lost nor duplicated. If zero, queries are not retried. It can't be set with DataBoost, whose partitioned
+	// queries can't be resumed.
+	MaxRetries uint
+
+	// RetryBackoff is the delay before the first retry of a table, which is doubled for each subsequent retry
+	// up to one minute. If zero, DefaultRetryBackoff is used.
+	RetryBackoff time.Duration
+
+	// DirectedReadOptions directs all queries, including the query of table schemas, to replicas,
+	// e.g. read-only replicas in a region. See ParseDirectedReadOptions. If nil, queries are served by any replica.
+	DirectedReadOptions *sppb.DirectedReadOptions
+
+	// CredentialsFile is the JSON credentials file, e.g. a service account key, which is used instead of
+	// Application Default Credentials.
+	CredentialsFile string
+
+	// Endpoint is the endpoint of Cloud Spanner, e.g. a private endpoint or a local stand-in like "localhost:9010".
+	Endpoint string
+
+	// ImpersonateServiceAccount is the email address of the service account to impersonate,
+	// which is authorized by CredentialsFile or Application Default Credentials.
+	ImpersonateServiceAccount string
+
+	// Insecure connects to Endpoint without TLS and authentication, e.g. to the emulator.
+	// SPANNER_EMULATOR_HOST is used as Endpoint if Endpoint is empty.
+	//
+	// CredentialsFile, Endpoint, ImpersonateServiceAccount and Insecure are applied to both clients created
+	// by NewDumper, and ignored by NewDumperWithClients.
+	Insecure bool
+
+	// DatabaseRole is the database role of fine-grained access control to access the database as.
+	// If set, tables and columns which the role can't read are skipped with warnings, both by DumpDDLs and DumpTables.
+	// It's ignored by NewDumperWithClients, whose client should be created with the role.
+	DatabaseRole string
+
+	// Warnings is the destination of warnings, e.g. os.Stderr. If nil, warnings are discarded.
+	Warnings io.Writer
+
+	// CollectStats collects statistics of DumpTables including query statistics, which are returned by Stats.
+	CollectStats bool
+
+	// Encoder is used to write table records if set.
+	// Format, BulkSize, PendingCommitTimestamp, OmitDefaultColumns and CSVNull are ignored in that case.
+	Encoder RowEncoder
+}
+
+// Dumper is a dumper to export a database.
+type Dumper struct {
+	dbPath    string
+	tables    map[string]bool
+	objects   map[string]bool
+	out       io.Writer
+	timestamp *time.Time
+	encoder   RowEncoder
+
+	staleness    time.Duration
+	maxStaleness time.Duration
+
+	// unsupportedTypes is one of UnsupportedTypesError, UnsupportedTypesSkip and UnsupportedTypesNull.
+	unsupportedTypes string
+
+	progress     io.Writer
+	bytesWritten func() int64
+	requestTag   string
+	priority     sppb.RequestOptions_Priority
+	dataBoost    bool
+	maxRetries   uint
+	retryBackoff time.Duration
+	directedRead *sppb.DirectedReadOptions
+	databaseRole string
+	warnings     io.Writer
+	// warned records warnings which have been written.
+	warned map[string]bool
+	// stats is non-nil if Options.CollectStats is set.
+	stats   *Stats
+	metrics *tableMetrics
+
+	// readTimestamp is the timestamp at which DumpTables read the database.
+	readTimestamp time.Time
+	// ddl is the response of GetDatabaseDdl, which is cached so that DDLs and proto descriptors are consistent.
+	ddl *adminpb.GetDatabaseDdlResponse
+
+	client      *spanner.Client
+	adminClient *adminapi.DatabaseAdminClient
+	// ownsClients is true if the clients are created by Dumper and should be closed by Cleanup.
+	ownsClients bool
+}
+
+// NewDumper creates Dumper with specified options.
+func NewDumper(ctx context.Context, opts Options) (*Dumper, error) {
+	if opts.Project == "" || opts.Instance == "" || opts.Database == "" {
+		return nil, errors.New("project, instance and database are required")
+	}
+
+	// Validate options before creating clients.
+	encoder, bytesWritten, err := newEncoderFromOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := newObjectTypes(opts.Objects)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUnsupportedTypes(opts.UnsupportedTypes); err != nil {
+		return nil, err
+	}
+	if err := validateTimestampBound(opts); err != nil {
+		return nil, err
+	}
+	if err := validateRetries(opts); err != nil {
+		return nil, err
+	}
+
+	clientOpts, err := clientOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	_, insecure := connection(opts)
+	dbPath := fmt.Sprintf("projects/%s/instances/%s/databases/%s", opts.Project, opts.Instance, opts.Database)
+	client, err := spanner.NewClientWithConfig(ctx, dbPath, spanner.ClientConfig{
+		SessionPoolConfig: spanner.SessionPoolConfig{
+			MinOpened: 1,
+			MaxOpened: 1,
+		},
+		DatabaseRole: opts.DatabaseRole,
+		// Built-in metrics can't be exported to Cloud Monitoring without authentication.
+		DisableNativeMetrics: insecure,
+	}, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spanner client: %v", err)
+	}
+
+	adminClient, err := adminapi.NewDatabaseAdminClient(ctx, clientOpts...)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create spanner admin client: %v", err)
+	}
+
+	d := newDumper(opts, encoder, bytesWritten, objects, client, adminClient)
+	d.ownsClients = true
+	return d, nil
+}
+
+// NewDumperWithClients creates Dumper which uses the given clients to access the database.
+// The database to dump is the one which client is connected to.
+//
+// The clients are not closed by Cleanup, so the caller is responsible for closing them.
+func NewDumperWithClients(ctx context.Context, opts Options, client *spanner.Client, adminClient *adminapi.DatabaseAdminClient) (*Dumper, error) {
+	if client == nil || adminClient == nil {
+		return nil, errors.New("client and admin client are required")
+	}
+
+	encoder, bytesWritten, err := newEncoderFromOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := newObjectTypes(opts.Objects)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUnsupportedTypes(opts.UnsupportedTypes); err != nil {
+		return nil, err
+	}
+	if err := validateTimestampBound(opts); err != nil {
+		return nil, err
+	}
+	if err := validateRetries(opts); err != nil {
+		return nil, err
+	}
+	return newDumper(opts, encoder, bytesWritten, objects, client, adminClient), nil
+}
+
+// newEncoderFromOptions creates the encoder, and returns it with a function to count bytes written by the encoder.
+func newEncoderFromOptions(opts Options) (RowEncoder, func() int64, error) {
+	if opts.Encoder != nil {
+		return opts.Encoder, opts.BytesWritten, nil
+	}
+	format := opts.Format
+	if format == "" {
+		format = FormatSQL
+	}
+	counter := NewByteCounter(outputOf(opts))
+	encoder, err := NewEncoder(format, counter, EncoderOptions{
+		BulkSize:               opts.BulkSize,
+		PendingCommitTimestamp: opts.PendingCommitTimestamp,
+		OmitDefaultColumns:     opts.OmitDefaultColumns,
+		CSVNull:                opts.CSVNull,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return encoder, counter.Count, nil
+}
+
+// clientOptions returns options of both the Spanner client and the admin client from the connection options.
+func clientOptions(ctx context.Context, opts Options) ([]option.ClientOption, error) {
+	endpoint, insecure := connection(opts)
+	var clientOpts []option.ClientOption
+	if endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+	}
+	if insecure {
+		if endpoint == "" {
+			return nil, errors.New("endpoint is required for an insecure connection")
+		}
+		if opts.CredentialsFile != "" || opts.ImpersonateServiceAccount != "" {
+			return nil, errors.New("credentials can't be used with an insecure connection")
+		}
+		return append(clientOpts,
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+			option.WithoutAuthentication(),
+		), nil
+	}
+
+	var credsOpts []option.ClientOption
+	if opts.CredentialsFile != "" {
+		credsOpts = append(credsOpts, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+	if opts.ImpersonateServiceAccount != "" {
+		ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: opts.ImpersonateServiceAccount,
+			Scopes:          []string{cloudPlatformScope},
+		}, credsOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to impersonate service account: %v", err)
+		}
+		credsOpts = []option.ClientOption{option.WithTokenSource(ts)}
+	}
+	return append(clientOpts, credsOpts...), nil
+}
+
+// connection returns the endpoint of the options, and whether the connection to it is insecure.
+// If Options.Endpoint isn't set, SPANNER_EMULATOR_HOST is used as an insecure endpoint.
+func connection(opts Options) (endpoint string, insecure bool) {
+	if opts.Endpoint == "" {
+		if emulatorAddr := os.Getenv("SPANNER_EMULATOR_HOST"); emulatorAddr != "" {
+			return emulatorAddr, true
+		}
+	}
+	return opts.Endpoint, opts.Insecure
+}
+
+func validateUnsupportedTypes(s string) error {
+	switch s {
+	case "", UnsupportedTypesError, UnsupportedTypesSkip, UnsupportedTypesNull:
+		return nil
+	default:
+		return fmt.Errorf("unknown way to handle unsupported types: %q", s)
+	}
+}
+
+func validateTimestampBound(opts Options) error {
+	n := 0
+	for _, set := range []bool{opts.Timestamp != nil, opts.Staleness != 0, opts.MaxStaleness != 0} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return errors.New("only one of timestamp, staleness and max staleness can be set")
+	case opts.Staleness < 0 || opts.MaxStaleness < 0:
+		return errors.New("staleness must not be negative")
+	}
+	return nil
+}
+
+func validateRetries(opts Options) error {
+	if opts.MaxRetries > 0 && opts.DataBoost {
+		return errors.New("max retries can't be set with Data Boost, as partitioned queries can't be resumed")
+	}
+	return nil
+}
+
+func outputOf(opts Options) io.Writer {
+	if opts.Out == nil {
+		return os.Stdout
+	}
+	return opts.Out
+}
+
+func newDumper(opts Options, encoder RowEncoder, bytesWritten func() int64, objects map[string]bool, client *spanner.Client, adminClient *adminapi.DatabaseAdminClient) *Dumper {
+	d := &Dumper{
+		dbPath:      client.DatabaseName(),
+		tables:      map[string]bool{},
+		objects:     objects,
+		out:         outputOf(opts),
+		timestamp:   opts.Timestamp,
+		encoder:     encoder,
+		client:      client,
+		adminClient: adminClient,
+
+		unsupportedTypes: opts.UnsupportedTypes,
+		staleness:        opts.Staleness,
+		maxStaleness:     opts.MaxStaleness,
+		progress:         opts.Progress,
+		bytesWritten:     bytesWritten,
+		metrics:          newTableMetrics(),
+		requestTag:       opts.RequestTag,
+		priority:         opts.Priority,
+		dataBoost:        opts.DataBoost,
+		maxRetries:       opts.MaxRetries,
+		retryBackoff:     opts.RetryBackoff,
+		directedRead:     opts.DirectedReadOptions,
+		databaseRole:     opts.DatabaseRole,
+		warnings:         opts.Warnings,
+		warned:           map[string]bool{},
+	}
+	if d.priority == sppb.RequestOptions_PRIORITY_UNSPECIFIED {
+		d.priority = sppb.RequestOptions_PRIORITY_LOW
+	}
+	if d.requestTag == "" {
+		d.requestTag = DefaultRequestTag
+	}
+	if opts.CollectStats {
+		d.stats = &Stats{}
+	}
+	if d.unsupportedTypes == "" {
+		d.unsupportedTypes = UnsupportedTypesError
+	}
+	if d.retryBackoff == 0 {
+		d.retryBackoff = DefaultRetryBackoff
+	}
+
+	for _, table := range opts.Tables {
+		d.tables[strings.Trim(table, "`")] = true
+	}
+	return d
+}
+
+// Cleanup cleans up hold resources.
+// Clients given to NewDumperWithClients are not closed.
+func (d *Dumper) Cleanup() {
+	if !d.ownsClients {
+		return
+	}
+	d.client.Close()
+	d.adminClient.Close()
+}
+
+// DDLs returns all DDL statements in the database, without trailing semicolons.
+func (d *Dumper) DDLs(ctx context.Context) ([]string, error) {
+	resp, err := d.databaseDdl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Statements, nil
+}
+
+// ProtoDescriptors returns the serialized FileDescriptorSet of the proto bundle in the database,
+// which is required to restore CREATE PROTO BUNDLE. It returns nil if the database has no proto bundle.
+// The descriptors are of the same schema as DDLs, as they are fetched together.
+func (d *Dumper) ProtoDescriptors(ctx context.Context) ([]byte, error) {
+	resp, err := d.databaseDdl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.ProtoDescriptors, nil
+}
+
+// databaseDdl gets the schema of the database at the first call, and returns the same response afterwards.
+func (d *Dumper) databaseDdl(ctx context.Context) (*adminpb.GetDatabaseDdlResponse, error) {
+	if d.ddl != nil {
+		return d.ddl, nil
+	}
+	resp, err := d.adminClient.GetDatabaseDdl(ctx, &adminpb.GetDatabaseDdlRequest{
+		Database: d.dbPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.ddl = resp
+	return resp, nil
+}
+
+// DumpDDLs dumps DDLs in the database limited by Options.Tables and Options.Objects.
+// Statements are ordered so that objects are defined before the statements referring to them.
+func (d *Dumper) DumpDDLs(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "spanner_dump.DumpDDLs", attrDatabase.String(d.dbPath))
+	err := d.dumpDDLs(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (d *Dumper) dumpDDLs(ctx context.Context) error {
+	ddls, err := d.DDLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	stmts, err := parseDDLs(ddls)
+	if err != nil {
+		return err
+	}
+	stmts = sortDDLs(stmts)
+	tables := d.tables
+	if d.databaseRole != "" {
+		if tables, err = d.readableTableNames(ctx); err != nil {
+			return err
+		}
+	}
+	if len(d.tables) > 0 || d.databaseRole != "" {
+		stmts = filterDDLs(stmts, tables)
+	}
+	if len(d.objects) > 0 {
+		stmts = filterObjectTypes(stmts, d.objects)
+	}
+
+	for _, stmt := range stmts {
+		fmt.Fprintf(d.out, "%s;\n", stmt.text)
+	}
+
+	return nil
+}
+
+// IncompleteError is returned by DumpTables if it fails while dumping a table, e.g. by cancellation of the context.
+// Rows which have been read are flushed before returning, so the output ends with complete records:
+// all rows of the Completed tables followed by some rows of Table.
+type IncompleteError struct {
+	Completed []string
+	Table     string
+	Err       error
+}
+
+func (e *IncompleteError) Error() string {
+	return fmt.Sprintf("failed to dump table %s: %v", e.Table, e.Err)
+}
+
+// Unwrap returns the cause of the failure, e.g. context.Canceled.
+func (e *IncompleteError) Unwrap() error {
+	return e.Err
+}
+
+// DumpTables dumps all table records in the database.
+// If it fails while dumping a table, the error is *IncompleteError.
+func (d *Dumper) DumpTables(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "spanner_dump.DumpTables", attrDatabase.String(d.dbPath))
+	err := d.dumpTables(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (d *Dumper) dumpTables(ctx context.Context) error {
+	start := time.Now()
+	var txn *spanner.ReadOnlyTransaction
+	var batch *spanner.BatchReadOnlyTransaction
+	if d.dataBoost {
+		bound, err := d.timestampBound(ctx)
+		if err != nil {
+			return err
+		}
+		if batch, err = d.client.BatchReadOnlyTransaction(ctx, bound); err != nil {
+			return err
+		}
+		defer batch.Cleanup(ctx)
+		txn = &batch.ReadOnlyTransaction
+	} else {
+		var err error
+		if txn, err = d.readOnlyTransaction(ctx); err != nil {
+			return err
+		}
+		defer txn.Close()
+	}
+
+	iter, err := d.fetchTables(ctx, txn)
+	if err != nil {
+		return err
+	}
+
+	// The read timestamp is available after the first read in the transaction.
+	if d.readTimestamp, err = txn.Timestamp(); err != nil {
+		return err
+	}
+
+	var tables []*Table
+	if err := iter.Do(func(t *Table) error {
+		if len(d.tables) == 0 || d.tables[t.Name] {
+			tables = append(tables, t)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if tables, err = d.prepareTables(ctx, txn, tables, d.unsupportedTypes); err != nil {
+		return err
+	}
+
+	encoder := d.encoder
+	if d.progress != nil {
+		counts, err := d.countRows(ctx, txn, tables)
+		if err != nil {
+			return err
+		}
+		encoder = newProgressEncoder(encoder, d.progress, d.bytesWritten, counts)
+	}
+
+	var completed []string
+	for _, t := range tables {
+		if err := d.dumpTable(ctx, t, txn, batch, encoder); err != nil {
+			return &IncompleteError{Completed: completed, Table: t.Name, Err: err}
+		}
+		completed = append(completed, t.Name)
+	}
+	if err := encoder.Finish(); err != nil {
+		return err
+	}
+	if d.stats != nil {
+		d.stats.Database = d.dbPath
+		d.stats.ReadTimestamp = d.readTimestamp
+		d.stats.ElapsedSeconds = time.Since(start).Seconds()
+	}
+	return nil
+}
+
+// prepareTables returns the tables as they are dumped, i.e. limited to the columns which the database role can read,
+// and whose columns of unsupported types are handled as unsupportedTypes.
+func (d *Dumper) prepareTables(ctx context.Context, txn *spanner.ReadOnlyTransaction, tables []*Table, unsupportedTypes string) ([]*Table, error) {
+	if d.databaseRole != "" {
+		var err error
+		if tables, err = d.readableTables(ctx, txn, tables); err != nil {
+			return nil, err
+		}
+	}
+	return handleUnsupportedTypes(tables, unsupportedTypes)
+}
+
+// handleUnsupportedTypes checks column types of the tables, and returns copies of the tables
+// whose columns of unsupported types are handled as unsupportedTypes, e.g. UnsupportedTypesSkip.
+// It returns an error which lists all the columns of unsupported types which can't be handled.
+func handleUnsupportedTypes(tables []*Table, unsupportedTypes string) ([]*Table, error) {
+	var unsupported []string
+	handled := make([]*Table, 0, len(tables))
+	for _, t := range tables {
+		keys := map[string]bool{}
+		for _, k := range t.PrimaryKeys {
+			keys[k] = true
+		}
+
+		table := *t
+		table.Columns = nil
+		for _, c := range t.Columns {
+			switch {
+			case isSupportedType(c.Type):
+				table.Columns = append(table.Columns, c)
+			case keys[c.Name]:
+				unsupported = append(unsupported, fmt.Sprintf("%s.%s (%s, primary key)", t.Name, c.Name, c.Type))
+			case unsupportedTypes == UnsupportedTypesSkip:
+			case unsupportedTypes == UnsupportedTypesNull:
+				c.null = true
+				table.Columns = append(table.Columns, c)
+			default:
+				unsupported = append(unsupported, fmt.Sprintf("%s.%s (%s)", t.Name, c.Name, c.Type))
+			}
+		}
+		handled = append(handled, &table)
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("unsupported column types: %s", strings.Join(unsupported, ", "))
+	}
+	return handled, nil
+}
+
+// readOnlyTransaction creates a read-only transaction at the timestamp bound of the options.
+func (d *Dumper) readOnlyTransaction(ctx context.Context) (*spanner.ReadOnlyTransaction, error) {
+	bound, err := d.timestampBound(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.client.ReadOnlyTransaction().WithTimestampBound(bound), nil
+}
+
+// timestampBound returns the timestamp bound of Options.Timestamp, Options.Staleness or Options.MaxStaleness,
+// or a strong read if none of them is set.
+//
+// The bounded staleness is resolved into the read timestamp, as it's only available for single-use transactions.
+// The other timestamps are checked against the earliest version time of the database.
+func (d *Dumper) timestampBound(ctx context.Context) (spanner.TimestampBound, error) {
+	switch {
+	case d.timestamp != nil:
+		if err := d.checkVersionRetention(ctx, *d.timestamp); err != nil {
+			return spanner.TimestampBound{}, err
+		}
+		return spanner.ReadTimestamp(*d.timestamp), nil
+	case d.staleness > 0:
+		if err := d.checkVersionRetention(ctx, time.Now().Add(-d.staleness)); err != nil {
+			return spanner.TimestampBound{}, err
+		}
+		return spanner.ExactStaleness(d.staleness), nil
+	case d.maxStaleness > 0:
+		txn := d.client.Single().WithTimestampBound(spanner.MaxStaleness(d.maxStaleness))
+		defer txn.Close()
+		if err := txn.QueryWithOptions(ctx, spanner.NewStatement("SELECT 1"), d.queryOptions("resolve-timestamp")).Do(func(*spanner.Row) error {
+			return nil
+		}); err != nil {
+			return spanner.TimestampBound{}, fmt.Errorf("failed to resolve read timestamp within max staleness: %w", err)
+		}
+		ts, err := txn.Timestamp()
+		if err != nil {
+			return spanner.TimestampBound{}, fmt.Errorf("failed to resolve read timestamp within max staleness: %w", err)
+		}
+		return spanner.ReadTimestamp(ts), nil
+	default:
+		return spanner.StrongRead(), nil
+	}
+}
+
+// checkVersionRetention returns an error if versions at the read timestamp are no longer retained by the database,
+// instead of failing the first query with FAILED_PRECONDITION. The check is skipped with a warning
+// if the database can't be retrieved, e.g. without the permission spanner.databases.get.
+func (d *Dumper) checkVersionRetention(ctx context.Context, readTimestamp time.Time) error {
+	db, err := d.adminClient.GetDatabase(ctx, &adminpb.GetDatabaseRequest{Name: d.dbPath})
+	if err != nil {
+		d.warnf("Failed to check version retention of the database: %v\n", err)
+		return nil
+	}
+	if earliest := db.GetEarliestVersionTime(); earliest != nil && readTimestamp.Before(earliest.AsTime()) {
+		return fmt.Errorf("read timestamp %s is earlier than the earliest version time %s of the database, whose version_retention_period is %s",
+			readTimestamp.UTC().Format(time.RFC3339Nano), earliest.AsTime().UTC().Format(time.RFC3339Nano), db.GetVersionRetentionPeriod())
+	}
+	return nil
+}
+
+// ReadTimestamp returns the timestamp at which DumpTables read the database.
+// It returns zero time if DumpTables has not been called.
+func (d *Dumper) ReadTimestamp() time.Time {
+	return d.readTimestamp
+}
+
+// Stats returns statistics of DumpTables. It returns nil if Options.CollectStats is not set.
+func (d *Dumper) Stats() *Stats {
+	return d.stats
+}
+
+// DatabasePath returns the path of the database, like "projects/p/instances/i/databases/d".
+func (d *Dumper) DatabasePath() string {
+	return d.dbPath
+}
+
+// dumpTable writes all rows of the table to the encoder.
+// If batch is not nil, the table is read by partitioned queries with Data Boost in the batch transaction.
+func (d *Dumper) dumpTable(ctx context.Context, table *Table, txn *spanner.ReadOnlyTransaction, batch *spanner.BatchReadOnlyTransaction, encoder RowEncoder) (err error) {
+	ctx, span := startSpan(ctx, "spanner_dump.dumpTable", attrDatabase.String(d.dbPath), attrTable.String(table.Name))
+	defer func() { endSpan(span, err) }()
+
+	opts := d.queryOptions(table.Name)
+	var iters []*spanner.RowIterator
+	if batch != nil {
+		opts.DataBoostEnabled = true
+		partitions, err := batch.PartitionQueryWithOptions(ctx, tableQuery(table, false), spanner.PartitionOptions{}, opts)
+		if err != nil {
+			return fmt.Errorf("failed to partition query of %s: %w", table.Name, err)
+		}
+		for _, p := range partitions {
+			iters = append(iters, batch.Execute(ctx, p))
+		}
+	} else if d.stats != nil {
+		mode := sppb.ExecuteSqlRequest_PROFILE
+		opts.Mode = &mode
+	}
+	defer func() {
+		for _, iter := range iters {
+			iter.Stop()
+		}
+	}()
+
+	start, startBytes := time.Now(), d.writtenBytes()
+	if err := encoder.BeginTable(table); err != nil {
+		return err
+	}
+	var rows int64
+	var queryStats map[string]interface{}
+	if batch != nil {
+		rows, err = writeRows(iters, encoder, nil)
+	} else {
+		rows, queryStats, err = d.writeTableRows(ctx, table, txn, opts, encoder)
+	}
+	if err != nil {
+		// Flush rows which have been written, so that the output doesn't end with a truncated record.
+		encoder.EndTable()
+		return err
+	}
+
+	if err := encoder.EndTable(); err != nil {
+		return err
+	}
+	span.SetAttributes(attrRows.Int64(rows))
+	// The size is unknown if Options.Encoder is set without Options.BytesWritten.
+	var bytes *int64
+	if d.bytesWritten != nil {
+		n := d.bytesWritten() - startBytes
+		bytes = &n
+	}
+	d.metrics.record(ctx, d.dbPath, table.Name, rows, bytes, time.Since(start))
+	if d.stats != nil {
+		d.stats.addTable(TableStats{
+			Name:           table.Name,
+			Rows:           rows,
+			Bytes:          bytes,
+			ElapsedSeconds: time.Since(start).Seconds(),
+			QueryStats:     queryStats,
+		})
+	}
+	return nil
+}
+
+// writeRows writes all rows of the iterators to the encoder, and returns the number of rows.
+// If written is not nil, it's called with the values of each row after the row is written.
+func writeRows(iters []*spanner.RowIterator, encoder RowEncoder, written func(values []spanner.GenericColumnValue)) (int64, error) {
+	var rows int64
+	for _, iter := range iters {
+		for {
+			row, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return rows, err
+			}
+
+			values := make([]spanner.GenericColumnValue, row.Size())
+			for i := range values {
+				if err := row.Column(i, &values[i]); err != nil {
+					return rows, err
+				}
+			}
+			if err := encoder.WriteRow(values); err != nil {
+				return rows, err
+			}
+			if written != nil {
+				written(values)
+			}
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+// writtenBytes returns the number of bytes written by the encoder, or zero if it's unknown.
+func (d *Dumper) writtenBytes() int64 {
+	if d.bytesWritten == nil {
+		return 0
+	}
+	return d.bytesWritten()
+}
+
+// queryOptions returns options of queries with the priority and the directed read options of the dumper,
+// and the request tag "<prefix>/<tag>".
+func (d *Dumper) queryOptions(tag string) spanner.QueryOptions {
+	return spanner.QueryOptions{
+		Priority:            d.priority,
+		RequestTag:          d.requestTag + "/" + tag,
+		DirectedReadOptions: d.directedRead,
+	}
+}
+
+// fetchTables fetches tables with the request tag of the dumper.
+func (d *Dumper) fetchTables(ctx context.Context, txn *spanner.ReadOnlyTransaction) (*TableIterator, error) {
+	return fetchTables(ctx, txn, d.queryOptions("fetch-tables"))
+}
+
+// queryTable queries all rows of the table with the options. If orderByKey is true, rows are ordered by the primary key.
+func queryTable(ctx context.Context, table *Table, txn *spanner.ReadOnlyTransaction, orderByKey bool, opts spanner.QueryOptions) *spanner.RowIterator {
+	return txn.QueryWithOptions(ctx, tableQuery(table, orderByKey), opts)
+}
+
+// tableQuery returns the statement to query all rows of the table.
+func tableQuery(table *Table, orderByKey bool) spanner.Statement {
+	sql := fmt.Sprintf("SELECT %s FROM `%s`", table.selectList(), table.Name)
+	if orderByKey && len(table.PrimaryKeys) > 0 {
+		sql += " ORDER BY " + table.quotedPrimaryKeyList()
+	}
+	return spanner.NewStatement(sql)
+}
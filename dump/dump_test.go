@@ -0,0 +1,409 @@
+package dump
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+)
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		name     string
+		ddl      string
+		want     string
+		wantKind string
+		wantDeps []string
+	}{
+		{
+			name: "create table",
+			ddl: `CREATE TABLE table_name_1 (
+  column1 STRING(32) NOT NULL,
+  column2 TIMESTAMP NOT NULL OPTIONS (
+    allow_commit_timestamp = true
+  ),
+) PRIMARY KEY(column1);`,
+			want:     "table_name_1",
+			wantKind: "TABLE",
+		},
+		{
+			name: "create table, table enclosed by backtick (`)",
+			ddl: `CREATE TABLE ` + "`table_name_1`" + ` (
+  column1 STRING(32) NOT NULL,
+  column2 TIMESTAMP NOT NULL OPTIONS (
+    allow_commit_timestamp = true
+  ),
+) PRIMARY KEY(column1);`,
+			want:     "table_name_1",
+			wantKind: "TABLE",
+		},
+		{
+			name: "create table, include multiple spaces",
+			ddl: `   CREATE   TABLE    table_name_1     (
+  column1 STRING(32) NOT NULL,
+  column2 TIMESTAMP NOT NULL OPTIONS (
+    allow_commit_timestamp = true
+  ),
+) PRIMARY KEY(column1);`,
+			want:     "table_name_1",
+			wantKind: "TABLE",
+		},
+		{
+			name:     "create unique index",
+			ddl:      `CREATE UNIQUE INDEX table_name_1_column2_a ON table_name_1(column2);`,
+			want:     "table_name_1",
+			wantKind: "INDEX",
+		},
+		{
+			name:     "create index",
+			ddl:      `CREATE INDEX table_name_1_column2_a ON table_name_1(column2);`,
+			want:     "table_name_1",
+			wantKind: "INDEX",
+		},
+		{
+			name:     "create index, index name enclosed by backtick (`)",
+			ddl:      "CREATE INDEX `order` ON TABLE(`by`)",
+			want:     "TABLE",
+			wantKind: "INDEX",
+		},
+		{
+			name:     "create index, table name enclosed by backtick (`)",
+			ddl:      "CREATE INDEX `order` ON `TABLE`(`by`)",
+			want:     "TABLE",
+			wantKind: "INDEX",
+		},
+		{
+			name:     "create index, include multiple spaces",
+			ddl:      "  CREATE   INDEX    `order`   ON    TABLE(`by`)",
+			want:     "TABLE",
+			wantKind: "INDEX",
+		},
+		{
+			name:     "alter table",
+			ddl:      "ALTER TABLE t5 ADD FOREIGN KEY(T6Id) REFERENCES t6(Id);",
+			want:     "t5",
+			wantDeps: []string{"t6"},
+		},
+		{
+			name:     "alter table, table name enclosed by backtick (`)",
+			ddl:      "ALTER TABLE `t5` ADD FOREIGN KEY(T6Id) REFERENCES t6(Id);",
+			want:     "t5",
+			wantDeps: []string{"t6"},
+		},
+		{
+			name:     "alter table, include multiple spaces",
+			ddl:      "  ALTER  TABLE \r\n `t5`   ADD   FOREIGN   KEY(T6Id) REFERENCES t6(Id);",
+			want:     "t5",
+			wantDeps: []string{"t6"},
+		},
+		{
+			name:     "create table, interleaved with foreign key",
+			ddl:      "CREATE TABLE t3 (\n  T2Id INT64 NOT NULL,\n  T3Id INT64 NOT NULL,\n  CONSTRAINT fk FOREIGN KEY (T3Id) REFERENCES `t1` (Id),\n) PRIMARY KEY(T2Id, T3Id),\n  INTERLEAVE IN PARENT t2 ON DELETE CASCADE",
+			want:     "t3",
+			wantKind: "TABLE",
+			wantDeps: []string{"t1", "t2"},
+		},
+		{
+			name:     "create table, with sequence",
+			ddl:      "CREATE TABLE t1 (\n  Id INT64 DEFAULT (GET_NEXT_SEQUENCE_VALUE(SEQUENCE seq)),\n) PRIMARY KEY(Id)",
+			want:     "t1",
+			wantKind: "TABLE",
+			wantDeps: []string{"seq"},
+		},
+		{
+			name:     "create table, in named schema with unusual characters",
+			ddl:      "CREATE TABLE `sch`.`table-1` (\n  Id INT64,\n) PRIMARY KEY(Id)",
+			want:     "sch.table-1",
+			wantKind: "TABLE",
+			wantDeps: []string{"sch"},
+		},
+		{
+			name:     "create search index",
+			ddl:      "CREATE SEARCH INDEX si ON t1(Tokens) STORING (Name)",
+			want:     "t1",
+			wantKind: "SEARCH INDEX",
+		},
+		{
+			name:     "create vector index",
+			ddl:      "CREATE VECTOR INDEX vi ON t1(Embedding) WHERE Embedding IS NOT NULL OPTIONS (distance_type = 'COSINE')",
+			want:     "t1",
+			wantKind: "VECTOR INDEX",
+		},
+		{
+			name:     "alter index",
+			ddl:      "ALTER INDEX idx ADD STORED COLUMN Name",
+			wantKind: "",
+		},
+		{
+			name:     "create change stream",
+			ddl:      "CREATE CHANGE STREAM cs FOR t1, t2(Name, Tags) OPTIONS (retention_period = '1d')",
+			wantKind: "CHANGE STREAM",
+			wantDeps: []string{"t1", "t2"},
+		},
+		{
+			name:     "create change stream for all",
+			ddl:      "CREATE CHANGE STREAM cs FOR ALL",
+			wantKind: "CHANGE STREAM",
+		},
+		{
+			name:     "create view",
+			ddl:      "CREATE VIEW v SQL SECURITY INVOKER AS SELECT a.Id FROM t1 AS a, `t2` b JOIN t3 ON a.Id = t3.Id WHERE EXISTS (SELECT 1 FROM t4)",
+			wantKind: "VIEW",
+			wantDeps: []string{"t1", "t2", "t3", "t4"},
+		},
+		{
+			name:     "create sequence",
+			ddl:      "CREATE SEQUENCE seq OPTIONS (sequence_kind = 'bit_reversed_positive')",
+			wantKind: "SEQUENCE",
+		},
+		{
+			name:     "grant",
+			ddl:      "GRANT SELECT(Id, Name), INSERT ON TABLE t1, t2 TO ROLE r1, r2",
+			wantDeps: []string{"t1", "t2", "r1", "r2"},
+		},
+		{
+			name:     "create table named like an object kind",
+			ddl:      "CREATE TABLE Role (\n  Id INT64,\n) PRIMARY KEY(Id)",
+			want:     "Role",
+			wantKind: "TABLE",
+		},
+		{
+			name:     "create table named like an object kind, interleaved",
+			ddl:      "CREATE TABLE Model (\n  Id INT64,\n  SubId INT64,\n) PRIMARY KEY(Id, SubId),\n  INTERLEAVE IN PARENT Schema ON DELETE CASCADE",
+			want:     "Model",
+			wantKind: "TABLE",
+			wantDeps: []string{"Schema"},
+		},
+		{
+			name:     "create table named like an object kind, with foreign key",
+			ddl:      "CREATE TABLE Stream (\n  Id INT64,\n  CONSTRAINT fk FOREIGN KEY (Id) REFERENCES Index (Id),\n) PRIMARY KEY(Id)",
+			want:     "Stream",
+			wantKind: "TABLE",
+			wantDeps: []string{"Index"},
+		},
+		{
+			name:     "create index on table named like an object kind",
+			ddl:      "CREATE INDEX idx ON Schema(Name)",
+			want:     "Schema",
+			wantKind: "INDEX",
+		},
+		{
+			name: "alter table named like an object kind",
+			ddl:  "ALTER TABLE Role ADD COLUMN X INT64",
+			want: "Role",
+		},
+		{
+			name:     "alter table named like an object kind, with foreign key",
+			ddl:      "ALTER TABLE Index ADD CONSTRAINT fk FOREIGN KEY (Id) REFERENCES Model (Id)",
+			want:     "Index",
+			wantKind: "CONSTRAINT",
+			wantDeps: []string{"Model"},
+		},
+		{
+			name:     "grant on table named like an object kind",
+			ddl:      "GRANT SELECT ON TABLE Role, Stream TO ROLE reader",
+			wantDeps: []string{"Role", "Stream", "reader"},
+		},
+		{
+			name:     "grant on table function",
+			ddl:      "GRANT EXECUTE ON TABLE FUNCTION READ_cs TO ROLE reader",
+			wantDeps: []string{"READ_cs", "reader"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := parseDDL(tt.ddl)
+			if err != nil {
+				t.Fatalf("parseDDL() failed unexpectedly: %v", err)
+			}
+			if stmt.tableName != tt.want {
+				t.Errorf("parseDDL().tableName = %v, want %v", stmt.tableName, tt.want)
+			}
+			if stmt.kind != tt.wantKind {
+				t.Errorf("parseDDL().kind = %v, want %v", stmt.kind, tt.wantKind)
+			}
+			if len(stmt.dependencies) != len(tt.wantDeps) || (len(tt.wantDeps) > 0 && !equalStringSlice(stmt.dependencies, tt.wantDeps)) {
+				t.Errorf("parseDDL().dependencies = %v, want %v", stmt.dependencies, tt.wantDeps)
+			}
+		})
+	}
+}
+
+func TestSortAndFilterDDLs(t *testing.T) {
+	ddls := []string{
+		"CREATE VIEW v1 SQL SECURITY INVOKER AS SELECT t1.Id FROM t1",
+		"CREATE TABLE t1 (\n  Id INT64 DEFAULT (GET_NEXT_SEQUENCE_VALUE(SEQUENCE seq)),\n) PRIMARY KEY(Id)",
+		"CREATE TABLE t2 (\n  Id INT64,\n) PRIMARY KEY(Id)",
+		"CREATE SEQUENCE seq OPTIONS (sequence_kind = 'bit_reversed_positive')",
+		"CREATE INDEX t2_Id ON t2(Id)",
+		"ALTER INDEX t2_Id ADD STORED COLUMN Id",
+		"CREATE VIEW v2 SQL SECURITY INVOKER AS SELECT v1.Id FROM v1 JOIN t2 ON v1.Id = t2.Id",
+		"CREATE CHANGE STREAM cs1 FOR t1",
+		"CREATE CHANGE STREAM cs2 FOR ALL",
+		"CREATE ROLE r",
+		"GRANT SELECT ON VIEW v1 TO ROLE r",
+	}
+	stmts, err := parseDDLs(ddls)
+	if err != nil {
+		t.Fatalf("parseDDLs() failed unexpectedly: %v", err)
+	}
+	stmts = sortDDLs(stmts)
+
+	var got []string
+	for _, s := range stmts {
+		got = append(got, s.objectName)
+	}
+	want := []string{"seq", "t1", "v1", "t2", "t2_Id", "", "v2", "cs1", "cs2", "r", ""}
+	if !equalStringSlice(got, want) {
+		t.Errorf("sortDDLs() = %q, want = %q", got, want)
+	}
+
+	got = nil
+	for _, s := range filterDDLs(stmts, map[string]bool{"t1": true}) {
+		got = append(got, s.text)
+	}
+	want = []string{ddls[3], ddls[1], ddls[0], ddls[7], ddls[9], ddls[10]}
+	if !equalStringSlice(got, want) {
+		t.Errorf("filterDDLs() = %q, want = %q", got, want)
+	}
+}
+
+func TestFilterObjectTypes(t *testing.T) {
+	ddls := []string{
+		"CREATE TABLE t1 (\n  Id INT64,\n) PRIMARY KEY(Id)",
+		"CREATE INDEX t1_Id ON t1(Id)",
+		"ALTER TABLE t1 ADD COLUMN Name STRING(MAX)",
+		"CREATE VIEW v1 SQL SECURITY INVOKER AS SELECT t1.Id FROM t1",
+		"CREATE CHANGE STREAM cs FOR t1",
+		"ALTER CHANGE STREAM cs SET OPTIONS (retention_period = '7d')",
+		"CREATE ROLE r",
+		"GRANT SELECT ON TABLE t1 TO ROLE r",
+		"ALTER DATABASE db SET OPTIONS (version_retention_period = '7d')",
+		"CREATE FUNCTION f(x INT64) RETURNS INT64 SQL SECURITY INVOKER AS (x + 1)",
+	}
+	stmts, err := parseDDLs(ddls)
+	if err != nil {
+		t.Fatalf("parseDDLs() failed unexpectedly: %v", err)
+	}
+
+	for _, tt := range []struct {
+		types []string
+		want  []string
+	}{
+		{types: []string{ObjectTables}, want: []string{ddls[0], ddls[1], ddls[2]}},
+		{types: []string{ObjectViews, ObjectChangeStreams}, want: []string{ddls[3], ddls[4], ddls[5]}},
+		{types: []string{ObjectRoles, ObjectDatabaseOptions}, want: []string{ddls[6], ddls[7], ddls[8]}},
+		{types: []string{ObjectFunctions}, want: []string{ddls[9]}},
+	} {
+		types, err := newObjectTypes(tt.types)
+		if err != nil {
+			t.Fatalf("newObjectTypes(%v) failed unexpectedly: %v", tt.types, err)
+		}
+		var got []string
+		for _, s := range filterObjectTypes(stmts, types) {
+			got = append(got, s.text)
+		}
+		if !equalStringSlice(got, tt.want) {
+			t.Errorf("filterObjectTypes(%v) = %q, want = %q", tt.types, got, tt.want)
+		}
+	}
+
+	if _, err := newObjectTypes([]string{"tables", "unknown"}); err == nil {
+		t.Errorf("newObjectTypes() with an unknown type succeeded, want error")
+	}
+}
+
+func TestNewDumperWithClients(t *testing.T) {
+	ctx := context.Background()
+	dbPath := "projects/p/instances/i/databases/d"
+
+	// Clients don't connect to the endpoint until they are used.
+	clientOpts := []option.ClientOption{
+		option.WithEndpoint("localhost:1"),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+		option.WithoutAuthentication(),
+	}
+	client, err := spanner.NewClientWithConfig(ctx, dbPath, spanner.ClientConfig{
+		SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0, MaxOpened: 1},
+	}, clientOpts...)
+	if err != nil {
+		t.Fatalf("failed to create spanner client: %v", err)
+	}
+	defer client.Close()
+	adminClient, err := adminapi.NewDatabaseAdminClient(ctx, clientOpts...)
+	if err != nil {
+		t.Fatalf("failed to create spanner admin client: %v", err)
+	}
+	defer adminClient.Close()
+
+	if _, err := NewDumperWithClients(ctx, Options{}, nil, adminClient); err == nil {
+		t.Errorf("NewDumperWithClients() with nil client succeeded, want error")
+	}
+
+	dumper, err := NewDumperWithClients(ctx, Options{Tables: []string{"`t1`"}}, client, adminClient)
+	if err != nil {
+		t.Fatalf("NewDumperWithClients() failed unexpectedly: %v", err)
+	}
+	if dumper.dbPath != dbPath {
+		t.Errorf("dbPath = %q, want = %q", dumper.dbPath, dbPath)
+	}
+	if !dumper.tables["t1"] {
+		t.Errorf("tables = %v, want to contain %q", dumper.tables, "t1")
+	}
+
+	// Cleanup must not close the clients given by the caller.
+	dumper.Cleanup()
+	if state := adminClient.Connection().GetState(); state == connectivity.Shutdown {
+		t.Errorf("admin client is closed by Cleanup")
+	}
+}
+
+func TestConnection(t *testing.T) {
+	for _, tt := range []struct {
+		desc         string
+		opts         Options
+		emulatorHost string
+		wantEndpoint string
+		wantInsecure bool
+	}{
+		{
+			desc: "default",
+		},
+		{
+			desc:         "endpoint",
+			opts:         Options{Endpoint: "spanner.example.com:443"},
+			wantEndpoint: "spanner.example.com:443",
+		},
+		{
+			desc:         "insecure endpoint",
+			opts:         Options{Endpoint: "localhost:9010", Insecure: true},
+			wantEndpoint: "localhost:9010",
+			wantInsecure: true,
+		},
+		{
+			desc:         "emulator",
+			emulatorHost: "localhost:9010",
+			wantEndpoint: "localhost:9010",
+			wantInsecure: true,
+		},
+		{
+			desc:         "endpoint takes precedence over emulator",
+			opts:         Options{Endpoint: "spanner.example.com:443"},
+			emulatorHost: "localhost:9010",
+			wantEndpoint: "spanner.example.com:443",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			t.Setenv("SPANNER_EMULATOR_HOST", tt.emulatorHost)
+			endpoint, insecure := connection(tt.opts)
+			if endpoint != tt.wantEndpoint || insecure != tt.wantInsecure {
+				t.Errorf("connection() = (%q, %v), want = (%q, %v)", endpoint, insecure, tt.wantEndpoint, tt.wantInsecure)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// RowEncoder encodes table records into an output format.
+//
+// Dumper calls BeginTable, WriteRow for each row and EndTable for every table to dump,
+// and Finish once after all tables are dumped.
+//
+// NOTE: RowEncoder is not required to be goroutine-safe.
+type RowEncoder interface {
+	// BeginTable is called before any rows of the table are written.
+	BeginTable(table *Table) error
+	// WriteRow writes a single row. Values are in the same order as the columns of the table.
+	WriteRow(values []spanner.GenericColumnValue) error
+	// EndTable is called after all rows of the table are written.
+	EndTable() error
+	// Finish is called after all tables are dumped.
+	Finish() error
+}
+
+// EncoderOptions is a set of options given to EncoderFactory.
+type EncoderOptions struct {
+	// BulkSize is the number of rows in a single statement, for formats which support it.
+	BulkSize uint
+	// PendingCommitTimestamp writes non-NULL values of columns with allow_commit_timestamp=true as
+	// PENDING_COMMIT_TIMESTAMP(), for formats which support it, so that the columns have the commit timestamp of the restore.
+	PendingCommitTimestamp bool
+	// OmitDefaultColumns omits columns which have default values, so that the values are computed again on restore.
+	// Primary key columns are not omitted as rows of interleaved tables refer to them.
+	OmitDefaultColumns bool
+	// CSVNull is the field written for NULL in CSV, e.g. "\\N". If empty, NULL is an empty field,
+	// which is the same as an empty string.
+	CSVNull string
+}
+
+// EncoderFactory creates a RowEncoder writing to out.
+type EncoderFactory func(out io.Writer, opts EncoderOptions) RowEncoder
+
+// FormatSQL is the default output format, which consists of INSERT statements.
+const FormatSQL = "sql"
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFactory{}
+)
+
+func init() {
+	RegisterEncoder(FormatSQL, NewSQLEncoder)
+	RegisterEncoder(FormatCSV, NewCSVEncoder)
+	RegisterEncoder(FormatJSON, NewJSONEncoder)
+}
+
+// RegisterEncoder makes an output format available by the given name.
+// If RegisterEncoder is called twice with the same name, the latter one is used.
+func RegisterEncoder(name string, factory EncoderFactory) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[name] = factory
+}
+
+// Formats returns the sorted names of the registered output formats.
+func Formats() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	var names []string
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEncoder creates a RowEncoder for the registered output format.
+func NewEncoder(format string, out io.Writer, opts EncoderOptions) (RowEncoder, error) {
+	encodersMu.RLock()
+	factory, ok := encoders[format]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %q", format)
+	}
+	encoder := factory(out, opts)
+	if opts.OmitDefaultColumns {
+		encoder = &defaultColumnOmitter{encoder: encoder}
+	}
+	return encoder, nil
+}
+
+// SQLEncoder is a RowEncoder to write records as INSERT statements.
+type SQLEncoder struct {
+	out                    io.Writer
+	bulkSize               uint
+	pendingCommitTimestamp bool
+	table                  *Table
+	writer                 *BufferedWriter
+}
+
+// NewSQLEncoder creates SQLEncoder with specified options.
+func NewSQLEncoder(out io.Writer, opts EncoderOptions) RowEncoder {
+	bulkSize := opts.BulkSize
+	if bulkSize == 0 {
+		bulkSize = defaultBulkSize
+	}
+	return &SQLEncoder{
+		out:                    out,
+		bulkSize:               bulkSize,
+		pendingCommitTimestamp: opts.PendingCommitTimestamp,
+	}
+}
+
+// BeginTable implements RowEncoder.
+func (e *SQLEncoder) BeginTable(table *Table) error {
+	e.table = table
+	e.writer = NewBufferedWriter(table, e.out, e.bulkSize)
+	return nil
+}
+
+// WriteRow implements RowEncoder.
+func (e *SQLEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	decoded := make([]string, len(values))
+	for i, v := range values {
+		s, err := DecodeColumn(v)
+		if err != nil {
+			return err
+		}
+		if e.pendingCommitTimestamp && e.table.Columns[i].AllowCommitTimestamp && s != "NULL" {
+			s = "PENDING_COMMIT_TIMESTAMP()"
+		}
+		decoded[i] = s
+	}
+	e.writer.Write(decoded)
+	return nil
+}
+
+// EndTable implements RowEncoder.
+func (e *SQLEncoder) EndTable() error {
+	e.writer.Flush()
+	e.writer = nil
+	e.table = nil
+	return nil
+}
+
+// Finish implements RowEncoder.
+func (e *SQLEncoder) Finish() error {
+	return nil
+}
+
+type multiEncoder struct {
+	encoders []RowEncoder
+}
+
+// MultiEncoder creates a RowEncoder that duplicates its calls to all the given encoders, like io.MultiWriter.
+// If an encoder returns an error, the call stops and returns the error.
+func MultiEncoder(encoders ...RowEncoder) RowEncoder {
+	return &multiEncoder{encoders: encoders}
+}
+
+// BeginTable implements RowEncoder.
+func (e *multiEncoder) BeginTable(table *Table) error {
+	for _, enc := range e.encoders {
+		if err := enc.BeginTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRow implements RowEncoder.
+func (e *multiEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	for _, enc := range e.encoders {
+		if err := enc.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndTable implements RowEncoder.
+func (e *multiEncoder) EndTable() error {
+	for _, enc := range e.encoders {
+		if err := enc.EndTable(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish implements RowEncoder.
+func (e *multiEncoder) Finish() error {
+	for _, enc := range e.encoders {
+		if err := enc.Finish(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultColumnOmitter is a RowEncoder to remove columns which have default values before passing rows to the encoder.
+type defaultColumnOmitter struct {
+	encoder RowEncoder
+	// index is the positions of the columns to keep.
+	index []int
+}
+
+// BeginTable implements RowEncoder.
+func (e *defaultColumnOmitter) BeginTable(table *Table) error {
+	primaryKeys := map[string]bool{}
+	for _, pk := range table.PrimaryKeys {
+		primaryKeys[pk] = true
+	}
+	omitted := *table
+	omitted.Columns = nil
+	e.index = nil
+	for i, c := range table.Columns {
+		if c.Default != "" && !primaryKeys[c.Name] {
+			continue
+		}
+		omitted.Columns = append(omitted.Columns, c)
+		e.index = append(e.index, i)
+	}
+	return e.encoder.BeginTable(&omitted)
+}
+
+// WriteRow implements RowEncoder.
+func (e *defaultColumnOmitter) WriteRow(values []spanner.GenericColumnValue) error {
+	kept := make([]spanner.GenericColumnValue, len(e.index))
+	for i, idx := range e.index {
+		kept[i] = values[idx]
+	}
+	return e.encoder.WriteRow(kept)
+}
+
+// EndTable implements RowEncoder.
+func (e *defaultColumnOmitter) EndTable() error {
+	return e.encoder.EndTable()
+}
+
+// Finish implements RowEncoder.
+func (e *defaultColumnOmitter) Finish() error {
+	return e.encoder.Finish()
+}
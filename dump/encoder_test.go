@@ -0,0 +1,176 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+func encodeTables(t *testing.T, encoder RowEncoder, tables []*Table, rows [][][]interface{}) {
+	t.Helper()
+
+	for i, table := range tables {
+		if err := encoder.BeginTable(table); err != nil {
+			t.Fatalf("BeginTable(%v) failed unexpectedly: %v", table, err)
+		}
+		for _, row := range rows[i] {
+			values := make([]spanner.GenericColumnValue, len(row))
+			for j, v := range row {
+				values[j] = createColumnValue(t, v)
+			}
+			if err := encoder.WriteRow(values); err != nil {
+				t.Fatalf("WriteRow(%v) failed unexpectedly: %v", row, err)
+			}
+		}
+		if err := encoder.EndTable(); err != nil {
+			t.Fatalf("EndTable() failed unexpectedly: %v", err)
+		}
+	}
+	if err := encoder.Finish(); err != nil {
+		t.Fatalf("Finish() failed unexpectedly: %v", err)
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	tables := []*Table{
+		{Name: "t1", Columns: []Column{{Name: "Id", Type: "INT64"}, {Name: "Name", Type: "STRING(MAX)"}, {Name: "Data", Type: "BYTES(MAX)"}}},
+		{Name: "t2", Columns: []Column{{Name: "Id", Type: "INT64"}, {Name: "Values", Type: "ARRAY<INT64>"}}},
+	}
+	rows := [][][]interface{}{
+		{
+			{int64(1), "foo, \"bar\"", []byte("abc")},
+			{int64(2), spanner.NullString{}, []byte(nil)},
+		},
+		{
+			{int64(1), []int64{1, 2}},
+		},
+	}
+
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatSQL,
+			want: "INSERT INTO `t1` (`Id`, `Name`, `Data`) VALUES (1, \"foo, \\\"bar\\\"\", b\"\\x61\\x62\\x63\"), (2, NULL, NULL);\n" +
+				"INSERT INTO `t2` (`Id`, `Values`) VALUES (1, [1, 2]);\n",
+		},
+		{
+			format: FormatCSV,
+			want: "Id,Name,Data\n1,\"foo, \"\"bar\"\"\",YWJj\n2,,\n" +
+				"\n" +
+				"Id,Values\n1,\"[\"\"1\"\",\"\"2\"\"]\"\n",
+		},
+		{
+			format: FormatJSON,
+			want: `{"table":"t1","row":{"Id":"1","Name":"foo, \"bar\"","Data":"YWJj"}}` + "\n" +
+				`{"table":"t1","row":{"Id":"2","Name":null,"Data":null}}` + "\n" +
+				`{"table":"t2","row":{"Id":"1","Values":["1","2"]}}` + "\n",
+		},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			encoder, err := NewEncoder(tt.format, out, EncoderOptions{})
+			if err != nil {
+				t.Fatalf("NewEncoder(%q) failed unexpectedly: %v", tt.format, err)
+			}
+			encodeTables(t, encoder, tables, rows)
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVEncoder_Null(t *testing.T) {
+	tables := []*Table{
+		{Name: "t1", Columns: []Column{{Name: "Id", Type: "INT64"}, {Name: "Name", Type: "STRING(MAX)"}, {Name: "Values", Type: "ARRAY<INT64>"}}},
+	}
+	rows := [][][]interface{}{
+		{
+			{int64(1), "", []int64{}},
+			{int64(2), spanner.NullString{}, []int64(nil)},
+			{int64(3), "\\N", []int64{1}},
+		},
+	}
+
+	for _, tt := range []struct {
+		desc string
+		null string
+		want string
+	}{
+		{
+			desc: "default",
+			want: "Id,Name,Values\n1,,[]\n2,,\n3,\\N,\"[\"\"1\"\"]\"\n",
+		},
+		{
+			desc: "marker",
+			null: "\\N",
+			want: "Id,Name,Values\n1,,[]\n2,\\N,\\N\n3,\\N,\"[\"\"1\"\"]\"\n",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			encodeTables(t, NewCSVEncoder(out, EncoderOptions{CSVNull: tt.null}), tables, rows)
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type countingEncoder struct {
+	rows int
+}
+
+func (e *countingEncoder) BeginTable(table *Table) error                      { return nil }
+func (e *countingEncoder) WriteRow(values []spanner.GenericColumnValue) error { e.rows++; return nil }
+func (e *countingEncoder) EndTable() error                                    { return nil }
+func (e *countingEncoder) Finish() error                                      { return nil }
+
+func TestRegisterEncoder(t *testing.T) {
+	encoder := &countingEncoder{}
+	RegisterEncoder("counting", func(out io.Writer, opts EncoderOptions) RowEncoder {
+		return encoder
+	})
+
+	got, err := NewEncoder("counting", &bytes.Buffer{}, EncoderOptions{})
+	if err != nil {
+		t.Fatalf("NewEncoder() failed unexpectedly: %v", err)
+	}
+	if got != encoder {
+		t.Errorf("NewEncoder() = %v, want = %v", got, encoder)
+	}
+
+	found := false
+	for _, name := range Formats() {
+		if name == "counting" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Formats() = %v, want to contain %q", Formats(), "counting")
+	}
+
+	if _, err := NewEncoder("unknown", &bytes.Buffer{}, EncoderOptions{}); err == nil {
+		t.Errorf("NewEncoder(%q) succeeded, want error", "unknown")
+	}
+}
@@ -0,0 +1,1119 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cloudspannerecosystem/spanner-dump/internal/fakespanner"
+
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+const fakeDatabasePath = "projects/fake-project/instances/fake-instance/databases/fake-database"
+
+// fakeTable is a table served by the fake server.
+type fakeTable struct {
+	name        string
+	parent      string
+	columns     []*sppb.StructType_Field
+	types       []string
+	primaryKeys []string
+	rows        [][]*structpb.Value
+
+	// defaults and commitTimestamps are optional attributes of columns.
+	defaults         []string
+	commitTimestamps []bool
+}
+
+var fakeDDLs = []string{
+	"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n  Tags ARRAY<STRING(MAX)>,\n) PRIMARY KEY(Id)",
+	"CREATE TABLE t2 (\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id)",
+	"CREATE TABLE t3 (\n  T2Id INT64 NOT NULL,\n  T3Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id, T3Id),\n  INTERLEAVE IN PARENT t2 ON DELETE CASCADE",
+	"CREATE INDEX t1_Name ON t1(Name)",
+}
+
+// fakeTables are in the order of INFORMATION_SCHEMA query, i.e. ordered by table name.
+var fakeTables = []fakeTable{
+	{
+		name: "t1",
+		columns: []*sppb.StructType_Field{
+			fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+			fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+			fakespanner.Field("Tags", fakespanner.ArrayType(sppb.TypeCode_STRING)),
+		},
+		types:       []string{"INT64", "STRING(MAX)", "ARRAY<STRING(MAX)>"},
+		primaryKeys: []string{"Id"},
+		rows: [][]*structpb.Value{
+			{fakespanner.IntValue(1), fakespanner.StringValue("foo"), fakespanner.StringListValue("a", "b")},
+			{fakespanner.IntValue(2), fakespanner.NullValue(), fakespanner.NullValue()},
+			{fakespanner.IntValue(3), fakespanner.StringValue("bar"), fakespanner.StringListValue()},
+		},
+	},
+	{
+		name: "t2",
+		columns: []*sppb.StructType_Field{
+			fakespanner.Field("T2Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		},
+		types:       []string{"INT64"},
+		primaryKeys: []string{"T2Id"},
+		rows: [][]*structpb.Value{
+			{fakespanner.IntValue(1)},
+			{fakespanner.IntValue(2)},
+		},
+	},
+	{
+		name:   "t3",
+		parent: "t2",
+		columns: []*sppb.StructType_Field{
+			fakespanner.Field("T2Id", fakespanner.Type(sppb.TypeCode_INT64)),
+			fakespanner.Field("T3Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		},
+		types:       []string{"INT64", "INT64"},
+		primaryKeys: []string{"T2Id", "T3Id"},
+		rows: [][]*structpb.Value{
+			{fakespanner.IntValue(1), fakespanner.IntValue(1)},
+		},
+	},
+}
+
+// newFakeServer starts a fake server which serves fakeDDLs and fakeTables.
+func newFakeServer(t *testing.T) *fakespanner.Server {
+	t.Helper()
+
+	server, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	server.SetDDLs(fakeDatabasePath, fakeDDLs)
+	putFakeTables(server, "", fakeTables)
+	return server
+}
+
+// putFakeTables makes the server serve the tables for the database. If database is empty, they are served for any database.
+func putFakeTables(server *fakespanner.Server, database string, tables []fakeTable) {
+	put := func(sql string, rs *sppb.ResultSet) {
+		if database == "" {
+			server.PutStatementResult(sql, rs)
+		} else {
+			server.PutDatabaseStatementResult(database, sql, rs)
+		}
+	}
+
+	schema := fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("table", fakespanner.Type(sppb.TypeCode_STRING)),
+		fakespanner.Field("parent", fakespanner.Type(sppb.TypeCode_STRING)),
+		fakespanner.Field("columns", fakespanner.ArrayType(sppb.TypeCode_STRING)),
+		fakespanner.Field("types", fakespanner.ArrayType(sppb.TypeCode_STRING)),
+		fakespanner.Field("defaults", fakespanner.ArrayType(sppb.TypeCode_STRING)),
+		fakespanner.Field("commit_timestamps", fakespanner.ArrayType(sppb.TypeCode_BOOL)),
+		fakespanner.Field("primary_keys", fakespanner.ArrayType(sppb.TypeCode_STRING)),
+	})
+	for _, table := range tables {
+		parent := fakespanner.NullValue()
+		if table.parent != "" {
+			parent = fakespanner.StringValue(table.parent)
+		}
+		var columns []string
+		defaults := make([]string, len(table.columns))
+		commitTimestamps := make([]*structpb.Value, len(table.columns))
+		for i, c := range table.columns {
+			columns = append(columns, c.Name)
+			if table.defaults != nil {
+				defaults[i] = table.defaults[i]
+			}
+			commitTimestamps[i] = fakespanner.BoolValue(table.commitTimestamps != nil && table.commitTimestamps[i])
+		}
+		schema.Rows = append(schema.Rows, &structpb.ListValue{Values: []*structpb.Value{
+			fakespanner.StringValue(table.name),
+			parent,
+			fakespanner.StringListValue(columns...),
+			fakespanner.StringListValue(table.types...),
+			fakespanner.StringListValue(defaults...),
+			fakespanner.ListValue(commitTimestamps...),
+			fakespanner.StringListValue(table.primaryKeys...),
+		}})
+
+		tbl := &Table{Name: table.name, PrimaryKeys: table.primaryKeys}
+		for _, c := range columns {
+			tbl.Columns = append(tbl.Columns, Column{Name: c})
+		}
+		// Rows are sorted by the primary key, so the same result is used for queries with ORDER BY.
+		rs := fakespanner.NewResultSet(table.columns, table.rows...)
+		put("SELECT "+tbl.quotedColumnList()+" FROM `"+table.name+"`", rs)
+		put("SELECT "+tbl.quotedColumnList()+" FROM `"+table.name+"` ORDER BY "+tbl.quotedPrimaryKeyList(), rs)
+		put("SELECT COUNT(*) FROM `"+table.name+"`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+			fakespanner.Field("", fakespanner.Type(sppb.TypeCode_INT64)),
+		}, []*structpb.Value{fakespanner.IntValue(int64(len(table.rows)))}))
+	}
+	put(fetchTablesSQL, schema)
+}
+
+// newFakeClients creates clients connected to the fake server.
+func newFakeClients(t *testing.T, server *fakespanner.Server, database string) (*spanner.Client, *adminapi.DatabaseAdminClient) {
+	t.Helper()
+
+	ctx := context.Background()
+	client, err := spanner.NewClientWithConfig(ctx, database, spanner.ClientConfig{
+		SessionPoolConfig: spanner.SessionPoolConfig{
+			MinOpened: 1,
+			MaxOpened: 1,
+		},
+		// Built-in metrics would be exported to Cloud Monitoring when the client is closed.
+		DisableNativeMetrics: true,
+	}, server.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create spanner client: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	adminClient, err := adminapi.NewDatabaseAdminClient(ctx, server.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create spanner admin client: %v", err)
+	}
+	t.Cleanup(func() { adminClient.Close() })
+
+	return client, adminClient
+}
+
+func newFakeDumper(t *testing.T, server *fakespanner.Server, opts Options) *Dumper {
+	t.Helper()
+
+	client, adminClient := newFakeClients(t, server, fakeDatabasePath)
+	dumper, err := NewDumperWithClients(context.Background(), opts, client, adminClient)
+	if err != nil {
+		t.Fatalf("failed to create dumper: %v", err)
+	}
+	t.Cleanup(dumper.Cleanup)
+	return dumper
+}
+
+func dumpAll(t *testing.T, dumper *Dumper) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := dumper.DumpDDLs(ctx); err != nil {
+		t.Fatalf("failed to dump DDLs: %v", err)
+	}
+	if err := dumper.DumpTables(ctx); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+}
+
+func TestDumpWithFakeServer(t *testing.T) {
+	server := newFakeServer(t)
+
+	for _, tt := range []struct {
+		desc string
+		opts Options
+		want string
+	}{
+		{
+			desc: "all tables",
+			opts: Options{BulkSize: 2},
+			want: "CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n  Tags ARRAY<STRING(MAX)>,\n) PRIMARY KEY(Id);\n" +
+				"CREATE TABLE t2 (\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id);\n" +
+				"CREATE TABLE t3 (\n  T2Id INT64 NOT NULL,\n  T3Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id, T3Id),\n  INTERLEAVE IN PARENT t2 ON DELETE CASCADE;\n" +
+				"CREATE INDEX t1_Name ON t1(Name);\n" +
+				"INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (1, \"foo\", [\"a\", \"b\"]), (2, NULL, NULL);\n" +
+				"INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (3, \"bar\", []);\n" +
+				"INSERT INTO `t2` (`T2Id`) VALUES (1), (2);\n" +
+				"INSERT INTO `t3` (`T2Id`, `T3Id`) VALUES (1, 1);\n",
+		},
+		{
+			desc: "selected tables",
+			opts: Options{Tables: []string{"`t1`", "t3"}},
+			want: "CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n  Tags ARRAY<STRING(MAX)>,\n) PRIMARY KEY(Id);\n" +
+				"CREATE TABLE t3 (\n  T2Id INT64 NOT NULL,\n  T3Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id, T3Id),\n  INTERLEAVE IN PARENT t2 ON DELETE CASCADE;\n" +
+				"CREATE INDEX t1_Name ON t1(Name);\n" +
+				"INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (1, \"foo\", [\"a\", \"b\"]), (2, NULL, NULL), (3, \"bar\", []);\n" +
+				"INSERT INTO `t3` (`T2Id`, `T3Id`) VALUES (1, 1);\n",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			opts.Out = out
+			dumpAll(t, newFakeDumper(t, server, opts))
+
+			if got := out.String(); got != tt.want {
+				t.Errorf("dump = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpTablesWithFakeServer_CSV(t *testing.T) {
+	server := newFakeServer(t)
+
+	out := &bytes.Buffer{}
+	dumper := newFakeDumper(t, server, Options{Out: out, Format: FormatCSV, Tables: []string{"t2", "t3"}})
+	if err := dumper.DumpTables(context.Background()); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+
+	want := "T2Id\n1\n2\n\nT2Id,T3Id\n1,1\n"
+	if got := out.String(); got != want {
+		t.Errorf("DumpTables() = %q, want = %q", got, want)
+	}
+}
+
+func TestDumpTablesWithFakeServer_CommitTimestampAndDefaults(t *testing.T) {
+	server := newFakeServer(t)
+	database := "projects/fake-project/instances/fake-instance/databases/defaults"
+	putFakeTables(server, database, []fakeTable{
+		{
+			name: "t4",
+			columns: []*sppb.StructType_Field{
+				fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+				fakespanner.Field("Status", fakespanner.Type(sppb.TypeCode_STRING)),
+				fakespanner.Field("UpdatedAt", fakespanner.Type(sppb.TypeCode_TIMESTAMP)),
+			},
+			types:            []string{"INT64", "STRING(MAX)", "TIMESTAMP"},
+			defaults:         []string{"GET_NEXT_SEQUENCE_VALUE(SEQUENCE seq)", "'new'", ""},
+			commitTimestamps: []bool{false, false, true},
+			primaryKeys:      []string{"Id"},
+			rows: [][]*structpb.Value{
+				{fakespanner.IntValue(1), fakespanner.StringValue("done"), fakespanner.StringValue("2020-01-23T03:00:00Z")},
+				{fakespanner.IntValue(2), fakespanner.StringValue("new"), fakespanner.NullValue()},
+			},
+		},
+	})
+
+	for _, tt := range []struct {
+		desc string
+		opts Options
+		want string
+	}{
+		{
+			desc: "no options",
+			opts: Options{},
+			want: "INSERT INTO `t4` (`Id`, `Status`, `UpdatedAt`) VALUES (1, \"done\", TIMESTAMP \"2020-01-23T03:00:00Z\"), (2, \"new\", NULL);\n",
+		},
+		{
+			desc: "pending commit timestamp",
+			opts: Options{PendingCommitTimestamp: true},
+			want: "INSERT INTO `t4` (`Id`, `Status`, `UpdatedAt`) VALUES (1, \"done\", PENDING_COMMIT_TIMESTAMP()), (2, \"new\", NULL);\n",
+		},
+		{
+			desc: "omit default columns except primary keys",
+			opts: Options{OmitDefaultColumns: true, PendingCommitTimestamp: true},
+			want: "INSERT INTO `t4` (`Id`, `UpdatedAt`) VALUES (1, PENDING_COMMIT_TIMESTAMP()), (2, NULL);\n",
+		},
+		{
+			desc: "omit default columns in CSV",
+			opts: Options{OmitDefaultColumns: true, Format: FormatCSV},
+			want: "Id,UpdatedAt\n1,2020-01-23T03:00:00Z\n2,\n",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			opts.Out = out
+			client, adminClient := newFakeClients(t, server, database)
+			dumper, err := NewDumperWithClients(context.Background(), opts, client, adminClient)
+			if err != nil {
+				t.Fatalf("failed to create dumper: %v", err)
+			}
+			if err := dumper.DumpTables(context.Background()); err != nil {
+				t.Fatalf("failed to dump tables: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("DumpTables() = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpWithFakeServer_ProtoColumns(t *testing.T) {
+	server := newFakeServer(t)
+	database := "projects/fake-project/instances/fake-instance/databases/protos"
+	descriptors := []byte("\x0a\x0cfake.proto")
+	server.SetDDLs(database, []string{
+		"CREATE PROTO BUNDLE (\n  `example.Album`,\n  `example.Genre`,\n)",
+		"CREATE TABLE t5 (\n  Id INT64 NOT NULL,\n  Album `example.Album`,\n  Genres ARRAY<`example.Genre`>,\n) PRIMARY KEY(Id)",
+		"CREATE TABLE t6 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+	})
+	server.SetProtoDescriptors(database, descriptors)
+	album := &sppb.Type{Code: sppb.TypeCode_PROTO, ProtoTypeFqn: "example.Album"}
+	genres := &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: sppb.TypeCode_ENUM, ProtoTypeFqn: "example.Genre"}}
+	putFakeTables(server, database, []fakeTable{
+		{
+			name: "t5",
+			columns: []*sppb.StructType_Field{
+				fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+				fakespanner.Field("Album", album),
+				fakespanner.Field("Genres", genres),
+			},
+			types:       []string{"INT64", "PROTO<example.Album>", "ARRAY<ENUM<example.Genre>>"},
+			primaryKeys: []string{"Id"},
+			rows: [][]*structpb.Value{
+				{fakespanner.IntValue(1), fakespanner.StringValue("CgNmb28="), fakespanner.StringListValue("1", "2")},
+				{fakespanner.IntValue(2), fakespanner.NullValue(), fakespanner.NullValue()},
+			},
+		},
+	})
+
+	out := &bytes.Buffer{}
+	client, adminClient := newFakeClients(t, server, database)
+	dumper, err := NewDumperWithClients(context.Background(), Options{Out: out, Tables: []string{"t5"}}, client, adminClient)
+	if err != nil {
+		t.Fatalf("failed to create dumper: %v", err)
+	}
+	dumpAll(t, dumper)
+
+	wantDDLs := []string{
+		"CREATE PROTO BUNDLE (\n  `example.Album`,\n  `example.Genre`,\n)",
+		"CREATE TABLE t5 (\n  Id INT64 NOT NULL,\n  Album `example.Album`,\n  Genres ARRAY<`example.Genre`>,\n) PRIMARY KEY(Id)",
+	}
+	wantDML := "INSERT INTO `t5` (`Id`, `Album`, `Genres`) VALUES (1, CAST(b\"\\x0a\\x03\\x66\\x6f\\x6f\" AS `example.Album`), [CAST(1 AS `example.Genre`), CAST(2 AS `example.Genre`)]), (2, NULL, NULL)"
+	want := strings.Join(append(wantDDLs, wantDML), ";\n") + ";\n"
+	if got := out.String(); got != want {
+		t.Errorf("dump = %q, want = %q", got, want)
+	}
+
+	// The descriptors are of the schema dumped above, even if the schema has been changed since then.
+	server.SetProtoDescriptors(database, []byte("\x0a\x0dother.proto"))
+	got, err := dumper.ProtoDescriptors(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get proto descriptors: %v", err)
+	}
+	if !bytes.Equal(got, descriptors) {
+		t.Errorf("ProtoDescriptors() = %q, want = %q", got, descriptors)
+	}
+
+	// The dump is restored with the descriptors.
+	ctx := context.Background()
+	restoreDatabasePath := "projects/fake-project/instances/fake-instance/databases/protos-restored"
+	restoreClient, restoreAdminClient := newFakeClients(t, server, restoreDatabasePath)
+	op, err := restoreAdminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:         restoreDatabasePath,
+		Statements:       wantDDLs,
+		ProtoDescriptors: got,
+	})
+	if err != nil {
+		t.Fatalf("failed to apply DDLs: %v", err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Fatalf("failed to apply DDLs: %v", err)
+	}
+	if _, err := restoreClient.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		_, err := txn.Update(ctx, spanner.NewStatement(wantDML))
+		return err
+	}); err != nil {
+		t.Fatalf("failed to apply DML %q: %v", wantDML, err)
+	}
+	if executed := server.ExecutedStatements(); executed[len(executed)-1] != wantDML {
+		t.Errorf("restored DML = %q, want = %q", executed[len(executed)-1], wantDML)
+	}
+	restored, err := NewDumperWithClients(ctx, Options{Out: &bytes.Buffer{}}, restoreClient, restoreAdminClient)
+	if err != nil {
+		t.Fatalf("failed to create dumper: %v", err)
+	}
+	if got, err := restored.ProtoDescriptors(ctx); err != nil || !bytes.Equal(got, descriptors) {
+		t.Errorf("restored ProtoDescriptors() = %q, %v, want = %q", got, err, descriptors)
+	}
+}
+
+func TestDumpTablesWithFakeServer_UnsupportedTypes(t *testing.T) {
+	server := newFakeServer(t)
+	database := "projects/fake-project/instances/fake-instance/databases/unsupported"
+	putFakeTables(server, database, []fakeTable{
+		{
+			name: "t7",
+			columns: []*sppb.StructType_Field{
+				fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+				fakespanner.Field("Shape", fakespanner.Type(sppb.TypeCode_STRING)),
+				fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+			},
+			types:       []string{"INT64", "GEOGRAPHY", "STRING(MAX)"},
+			primaryKeys: []string{"Id"},
+			rows: [][]*structpb.Value{
+				{fakespanner.IntValue(1), fakespanner.StringValue("POINT(1 2)"), fakespanner.StringValue("foo")},
+			},
+		},
+	})
+	// Fake results of the queries with the unsupported column skipped or nulled.
+	server.PutDatabaseStatementResult(database, "SELECT `Id`, `Name` FROM `t7`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+	}, []*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("foo")}))
+	server.PutDatabaseStatementResult(database, "SELECT `Id`, NULL AS `Shape`, `Name` FROM `t7`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		fakespanner.Field("Shape", fakespanner.Type(sppb.TypeCode_INT64)),
+		fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+	}, []*structpb.Value{fakespanner.IntValue(1), fakespanner.NullValue(), fakespanner.StringValue("foo")}))
+
+	for _, tt := range []struct {
+		desc    string
+		opts    Options
+		want    string
+		wantErr bool
+	}{
+		{
+			desc:    "error by default",
+			opts:    Options{},
+			wantErr: true,
+		},
+		{
+			desc: "skip",
+			opts: Options{UnsupportedTypes: UnsupportedTypesSkip},
+			want: "INSERT INTO `t7` (`Id`, `Name`) VALUES (1, \"foo\");\n",
+		},
+		{
+			desc: "null",
+			opts: Options{UnsupportedTypes: UnsupportedTypesNull},
+			want: "INSERT INTO `t7` (`Id`, `Shape`, `Name`) VALUES (1, NULL, \"foo\");\n",
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			opts.Out = out
+			client, adminClient := newFakeClients(t, server, database)
+			dumper, err := NewDumperWithClients(context.Background(), opts, client, adminClient)
+			if err != nil {
+				t.Fatalf("failed to create dumper: %v", err)
+			}
+			err = dumper.DumpTables(context.Background())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "t7.Shape (GEOGRAPHY)") {
+					t.Errorf("DumpTables() = %v, want error for t7.Shape", err)
+				}
+				if out.Len() > 0 {
+					t.Errorf("DumpTables() wrote %q before failing", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to dump tables: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("DumpTables() = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpTablesWithFakeServer_Progress(t *testing.T) {
+	server := newFakeServer(t)
+
+	out, progress := &bytes.Buffer{}, &bytes.Buffer{}
+	dumper := newFakeDumper(t, server, Options{Out: out, Progress: progress, Tables: []string{"t1", "t2"}})
+	if err := dumper.DumpTables(context.Background()); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+
+	got := progress.String()
+	for _, want := range []string{
+		"\rt1: 0/3 rows | total 0/5 rows (0%)",
+		"t1: 3 rows in ",
+		"\rt2: 0/2 rows | total 3/5 rows (60%)",
+		"t2: 2 rows in ",
+		fmt.Sprintf("Dumped 5 rows, %s in ", formatBytes(int64(out.Len()))),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("progress = %q, want to contain %q", got, want)
+		}
+	}
+	if strings.Contains(out.String(), "rows") {
+		t.Errorf("progress is written to the output: %q", out.String())
+	}
+}
+
+func TestDumpTablesWithFakeServer_Stats(t *testing.T) {
+	server := newFakeServer(t)
+	rs := fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("T2Id", fakespanner.Type(sppb.TypeCode_INT64)),
+	}, []*structpb.Value{fakespanner.IntValue(1)}, []*structpb.Value{fakespanner.IntValue(2)})
+	queryStats, err := structpb.NewStruct(map[string]interface{}{"rows_scanned": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Stats = &sppb.ResultSetStats{QueryStats: queryStats}
+	server.PutStatementResult("SELECT `T2Id` FROM `t2`", rs)
+
+	out := &bytes.Buffer{}
+	dumper := newFakeDumper(t, server, Options{Out: out, CollectStats: true, Tables: []string{"t1", "t2"}})
+	if err := dumper.DumpTables(context.Background()); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+
+	stats := dumper.Stats()
+	if stats.Database != dumper.DatabasePath() || !stats.ReadTimestamp.Equal(dumper.ReadTimestamp()) {
+		t.Errorf("Stats() = %+v, want database %s and read timestamp %v", stats, dumper.DatabasePath(), dumper.ReadTimestamp())
+	}
+	if stats.Rows != 5 || stats.Bytes == nil || *stats.Bytes != int64(out.Len()) {
+		t.Errorf("Stats() has %d rows and %v bytes, want 5 rows and %d bytes", stats.Rows, stats.Bytes, out.Len())
+	}
+	if len(stats.Tables) != 2 {
+		t.Fatalf("Stats() has %d tables, want 2", len(stats.Tables))
+	}
+	if got := stats.Tables[0]; got.Name != "t1" || got.Rows != 3 || got.QueryStats != nil {
+		t.Errorf("Stats().Tables[0] = %+v, want 3 rows of t1 without query stats", got)
+	}
+	if got := stats.Tables[1]; got.Name != "t2" || got.Rows != 2 || got.QueryStats["rows_scanned"] != "2" {
+		t.Errorf("Stats().Tables[1] = %+v, want 2 rows of t2 with query stats", got)
+	}
+}
+
+func TestDumpTablesWithFakeServer_StatsWithoutBytes(t *testing.T) {
+	server := newFakeServer(t)
+
+	// The size is unknown, as the encoder is given without BytesWritten.
+	dumper := newFakeDumper(t, server, Options{Encoder: NewSQLEncoder(&bytes.Buffer{}, EncoderOptions{}), CollectStats: true, Tables: []string{"t2"}})
+	if err := dumper.DumpTables(context.Background()); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+
+	stats := dumper.Stats()
+	if stats.Bytes != nil || len(stats.Tables) != 1 || stats.Tables[0].Bytes != nil {
+		t.Errorf("Stats() = %+v, want no bytes", stats)
+	}
+	b := &bytes.Buffer{}
+	if err := stats.Write(b); err != nil {
+		t.Fatalf("failed to write stats: %v", err)
+	}
+	if strings.Contains(b.String(), `"bytes"`) {
+		t.Errorf("stats = %s, want no bytes", b)
+	}
+	if got, want := stats.Summary(), "Dumped 2 rows of 1 tables in "; !strings.HasPrefix(got, want) {
+		t.Errorf("Summary() = %q, want prefix %q", got, want)
+	}
+}
+
+func TestDumpTablesWithFakeServer_RequestTags(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		opts Options
+		want []string
+	}{
+		{
+			desc: "default",
+			opts: Options{Tables: []string{"t2"}},
+			want: []string{"spanner-dump/fetch-tables", "spanner-dump/t2"},
+		},
+		{
+			desc: "custom prefix with progress",
+			opts: Options{Tables: []string{"t2"}, RequestTag: "nightly", Progress: &bytes.Buffer{}},
+			want: []string{"nightly/fetch-tables", "nightly/t2/count", "nightly/t2"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			server := newFakeServer(t)
+			opts := tt.opts
+			opts.Out = &bytes.Buffer{}
+			dumper := newFakeDumper(t, server, opts)
+			if err := dumper.DumpTables(context.Background()); err != nil {
+				t.Fatalf("failed to dump tables: %v", err)
+			}
+
+			var got []string
+			for _, req := range server.ExecutedRequests() {
+				if req.GetRequestOptions().GetPriority() != sppb.RequestOptions_PRIORITY_LOW {
+					t.Errorf("request %q has priority %v, want PRIORITY_LOW", req.Sql, req.GetRequestOptions().GetPriority())
+				}
+				got = append(got, req.GetRequestOptions().GetRequestTag())
+			}
+			if !equalStringSlice(got, tt.want) {
+				t.Errorf("request tags = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpTablesWithFakeServer_PriorityAndDataBoost(t *testing.T) {
+	for _, tt := range []struct {
+		desc          string
+		opts          Options
+		wantPriority  sppb.RequestOptions_Priority
+		wantDataBoost map[string]bool
+	}{
+		{
+			desc:          "default",
+			opts:          Options{Tables: []string{"t2"}},
+			wantPriority:  sppb.RequestOptions_PRIORITY_LOW,
+			wantDataBoost: map[string]bool{"spanner-dump/fetch-tables": false, "spanner-dump/t2": false},
+		},
+		{
+			desc:          "high priority",
+			opts:          Options{Tables: []string{"t2"}, Priority: sppb.RequestOptions_PRIORITY_HIGH},
+			wantPriority:  sppb.RequestOptions_PRIORITY_HIGH,
+			wantDataBoost: map[string]bool{"spanner-dump/fetch-tables": false, "spanner-dump/t2": false},
+		},
+		{
+			desc:          "data boost",
+			opts:          Options{Tables: []string{"t2"}, Priority: sppb.RequestOptions_PRIORITY_MEDIUM, DataBoost: true},
+			wantPriority:  sppb.RequestOptions_PRIORITY_MEDIUM,
+			wantDataBoost: map[string]bool{"spanner-dump/fetch-tables": false, "spanner-dump/t2": true},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			server := newFakeServer(t)
+			out := &bytes.Buffer{}
+			opts := tt.opts
+			opts.Out = out
+			dumper := newFakeDumper(t, server, opts)
+			if err := dumper.DumpTables(context.Background()); err != nil {
+				t.Fatalf("failed to dump tables: %v", err)
+			}
+			if want := "INSERT INTO `t2` (`T2Id`) VALUES (1), (2);\n"; out.String() != want {
+				t.Errorf("dump = %q, want = %q", out.String(), want)
+			}
+
+			got := map[string]bool{}
+			for _, req := range server.ExecutedRequests() {
+				if req.GetRequestOptions().GetPriority() != tt.wantPriority {
+					t.Errorf("request %q has priority %v, want %v", req.Sql, req.GetRequestOptions().GetPriority(), tt.wantPriority)
+				}
+				got[req.GetRequestOptions().GetRequestTag()] = req.DataBoostEnabled
+			}
+			if !reflect.DeepEqual(got, tt.wantDataBoost) {
+				t.Errorf("data boost of requests = %v, want = %v", got, tt.wantDataBoost)
+			}
+		})
+	}
+}
+
+func TestDumpTablesWithFakeServer_Staleness(t *testing.T) {
+	ts := time.Date(2020, 1, 23, 1, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		desc     string
+		opts     Options
+		earliest time.Time
+		// wantReadOnly is the options of the read-only transaction which reads tables.
+		wantReadOnly *sppb.TransactionOptions_ReadOnly
+		wantErr      string
+	}{
+		{
+			desc:         "timestamp",
+			opts:         Options{Timestamp: &ts},
+			earliest:     ts.Add(-time.Hour),
+			wantReadOnly: &sppb.TransactionOptions_ReadOnly{ReturnReadTimestamp: true, TimestampBound: &sppb.TransactionOptions_ReadOnly_ReadTimestamp{ReadTimestamp: timestamppb.New(ts)}},
+		},
+		{
+			desc:     "timestamp earlier than the earliest version time",
+			opts:     Options{Timestamp: &ts},
+			earliest: ts.Add(time.Minute),
+			wantErr:  "read timestamp 2020-01-23T01:00:00Z is earlier than the earliest version time 2020-01-23T01:01:00Z of the database, whose version_retention_period is 1h",
+		},
+		{
+			desc:         "exact staleness",
+			opts:         Options{Staleness: 15 * time.Second},
+			earliest:     time.Now().Add(-time.Hour),
+			wantReadOnly: &sppb.TransactionOptions_ReadOnly{ReturnReadTimestamp: true, TimestampBound: &sppb.TransactionOptions_ReadOnly_ExactStaleness{ExactStaleness: durationpb.New(15 * time.Second)}},
+		},
+		{
+			desc:     "exact staleness beyond the retention period",
+			opts:     Options{Staleness: 2 * time.Hour},
+			earliest: time.Now().Add(-time.Hour),
+			wantErr:  "is earlier than the earliest version time",
+		},
+		{
+			desc:     "max staleness resolved into the read timestamp",
+			opts:     Options{MaxStaleness: 10 * time.Second},
+			earliest: time.Now().Add(-time.Hour),
+			wantReadOnly: &sppb.TransactionOptions_ReadOnly{ReturnReadTimestamp: true, TimestampBound: &sppb.TransactionOptions_ReadOnly_ReadTimestamp{
+				ReadTimestamp: timestamppb.New(time.Date(2020, 1, 23, 3, 0, 0, 0, time.UTC)),
+			}},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			server := newFakeServer(t)
+			server.SetVersionRetention(fakeDatabasePath, "1h", tt.earliest)
+			server.PutStatementResult("SELECT 1", fakespanner.NewResultSet([]*sppb.StructType_Field{
+				fakespanner.Field("", fakespanner.Type(sppb.TypeCode_INT64)),
+			}, []*structpb.Value{fakespanner.IntValue(1)}))
+
+			opts := tt.opts
+			opts.Out = &bytes.Buffer{}
+			opts.Tables = []string{"t2"}
+			dumper := newFakeDumper(t, server, opts)
+			err := dumper.DumpTables(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DumpTables() = %v, want error %q", err, tt.wantErr)
+				}
+				if executed := server.ExecutedStatements(); len(executed) > 0 {
+					t.Errorf("DumpTables() executed %q before failing", executed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to dump tables: %v", err)
+			}
+
+			txns := server.TransactionOptions()
+			if len(txns) == 0 {
+				t.Fatalf("no transactions are begun")
+			}
+			if got := txns[len(txns)-1].GetReadOnly(); !proto.Equal(got, tt.wantReadOnly) {
+				t.Errorf("read-only transaction = %v, want = %v", got, tt.wantReadOnly)
+			}
+			if tt.opts.MaxStaleness > 0 {
+				single := txns[0].GetReadOnly()
+				if single.GetMaxStaleness().AsDuration() != tt.opts.MaxStaleness || !single.GetReturnReadTimestamp() {
+					t.Errorf("single-use transaction = %v, want max staleness %v", single, tt.opts.MaxStaleness)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDumperWithClients_TimestampBound(t *testing.T) {
+	server := newFakeServer(t)
+	client, adminClient := newFakeClients(t, server, fakeDatabasePath)
+	ts := time.Now()
+	for _, opts := range []Options{
+		{Timestamp: &ts, Staleness: time.Second},
+		{Staleness: time.Second, MaxStaleness: time.Second},
+		{Staleness: -time.Second},
+	} {
+		if _, err := NewDumperWithClients(context.Background(), opts, client, adminClient); err == nil {
+			t.Errorf("NewDumperWithClients(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestNewDumper_RetriesWithDataBoost(t *testing.T) {
+	server := newFakeServer(t)
+	client, adminClient := newFakeClients(t, server, fakeDatabasePath)
+	opts := Options{DataBoost: true, MaxRetries: 1}
+	if _, err := NewDumperWithClients(context.Background(), opts, client, adminClient); err == nil {
+		t.Errorf("NewDumperWithClients(%+v) succeeded, want error", opts)
+	}
+	opts.Project, opts.Instance, opts.Database = "fake-project", "fake-instance", "fake-database"
+	opts.Endpoint, opts.Insecure = server.Addr(), true
+	if _, err := NewDumper(context.Background(), opts); err == nil {
+		t.Errorf("NewDumper(%+v) succeeded, want error", opts)
+	}
+}
+
+func TestDumpTablesWithFakeServer_DirectedRead(t *testing.T) {
+	server := newFakeServer(t)
+	directedRead, err := ParseDirectedReadOptions("region:us-east1,type:READ_ONLY")
+	if err != nil {
+		t.Fatalf("failed to parse directed read options: %v", err)
+	}
+	dumper := newFakeDumper(t, server, Options{Out: &bytes.Buffer{}, Tables: []string{"t2"}, DirectedReadOptions: directedRead})
+	if err := dumper.DumpTables(context.Background()); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+
+	var tags []string
+	for _, req := range server.ExecutedRequests() {
+		if !proto.Equal(req.DirectedReadOptions, directedRead) {
+			t.Errorf("request %q has directed read options %v, want = %v", req.Sql, req.DirectedReadOptions, directedRead)
+		}
+		tags = append(tags, req.GetRequestOptions().GetRequestTag())
+	}
+	if want := []string{"spanner-dump/fetch-tables", "spanner-dump/t2"}; !equalStringSlice(tags, want) {
+		t.Errorf("request tags = %q, want = %q", tags, want)
+	}
+}
+
+func TestDumpWithFakeServer_DatabaseRole(t *testing.T) {
+	server := newFakeServer(t)
+	// The role can't read t1.Tags and t2.
+	denied := status.Error(codes.PermissionDenied, "role reader does not have required privileges")
+	server.PutStatementError("SELECT `Id`, `Name`, `Tags` FROM `t1` LIMIT 0", denied)
+	server.PutStatementError("SELECT `Tags` FROM `t1` LIMIT 0", denied)
+	server.PutStatementError("SELECT `T2Id` FROM `t2` LIMIT 0", denied)
+	field := func(name string) *sppb.StructType_Field {
+		return fakespanner.Field(name, fakespanner.Type(sppb.TypeCode_INT64))
+	}
+	server.PutStatementResult("SELECT `Id` FROM `t1` LIMIT 0", fakespanner.NewResultSet([]*sppb.StructType_Field{field("Id")}))
+	server.PutStatementResult("SELECT `Name` FROM `t1` LIMIT 0", fakespanner.NewResultSet([]*sppb.StructType_Field{field("Name")}))
+	server.PutStatementResult("SELECT `T2Id`, `T3Id` FROM `t3` LIMIT 0", fakespanner.NewResultSet([]*sppb.StructType_Field{field("T2Id"), field("T3Id")}))
+	server.PutStatementResult("SELECT `Id`, `Name` FROM `t1`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+		fakespanner.Field("Name", fakespanner.Type(sppb.TypeCode_STRING)),
+	},
+		[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("foo")},
+		[]*structpb.Value{fakespanner.IntValue(2), fakespanner.NullValue()},
+		[]*structpb.Value{fakespanner.IntValue(3), fakespanner.StringValue("bar")},
+	))
+
+	out, warnings := &bytes.Buffer{}, &bytes.Buffer{}
+	dumpAll(t, newFakeDumper(t, server, Options{Out: out, DatabaseRole: "reader", Warnings: warnings}))
+
+	want := "CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n  Tags ARRAY<STRING(MAX)>,\n) PRIMARY KEY(Id);\n" +
+		"CREATE TABLE t3 (\n  T2Id INT64 NOT NULL,\n  T3Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id, T3Id),\n  INTERLEAVE IN PARENT t2 ON DELETE CASCADE;\n" +
+		"CREATE INDEX t1_Name ON t1(Name);\n" +
+		"INSERT INTO `t1` (`Id`, `Name`) VALUES (1, \"foo\"), (2, NULL), (3, \"bar\");\n" +
+		"INSERT INTO `t3` (`T2Id`, `T3Id`) VALUES (1, 1);\n"
+	if got := out.String(); got != want {
+		t.Errorf("dump = %q, want = %q", got, want)
+	}
+	wantWarnings := "Skipped columns of table t1, which database role reader can't read: Tags\n" +
+		"Skipped table t2, which database role reader can't read\n"
+	if got := warnings.String(); got != wantWarnings {
+		t.Errorf("warnings = %q, want = %q", got, wantWarnings)
+	}
+}
+
+func TestNewDumperWithFakeServer_Endpoint(t *testing.T) {
+	server := newFakeServer(t)
+	ctx := context.Background()
+
+	out := &bytes.Buffer{}
+	dumper, err := NewDumper(ctx, Options{
+		Project:  "fake-project",
+		Instance: "fake-instance",
+		Database: "fake-database",
+		Out:      out,
+		Tables:   []string{"t2"},
+		Endpoint: server.Addr(),
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create dumper: %v", err)
+	}
+	defer dumper.Cleanup()
+	dumpAll(t, dumper)
+
+	want := "CREATE TABLE t2 (\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(T2Id);\n" +
+		"INSERT INTO `t2` (`T2Id`) VALUES (1), (2);\n"
+	if got := out.String(); got != want {
+		t.Errorf("dump = %q, want = %q", got, want)
+	}
+}
+
+func TestListDatabasesWithFakeServer(t *testing.T) {
+	server := newFakeServer(t)
+	server.SetDDLs("projects/fake-project/instances/fake-instance/databases/another-database", nil)
+	server.SetDDLs("projects/fake-project/instances/another-instance/databases/other-instance-database", nil)
+
+	got, err := ListDatabases(context.Background(), Options{
+		Project:  "fake-project",
+		Instance: "fake-instance",
+		Endpoint: server.Addr(),
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatalf("ListDatabases() failed: %v", err)
+	}
+	want := []string{"another-database", "fake-database"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListDatabases() = %v, want = %v", got, want)
+	}
+}
+
+func TestNewDumper_InsecureWithCredentials(t *testing.T) {
+	_, err := NewDumper(context.Background(), Options{
+		Project:         "fake-project",
+		Instance:        "fake-instance",
+		Database:        "fake-database",
+		Endpoint:        "localhost:9010",
+		Insecure:        true,
+		CredentialsFile: "credentials.json",
+	})
+	if err == nil {
+		t.Errorf("NewDumper() succeeded, want error")
+	}
+}
+
+func TestDumpTablesWithFakeServer_Error(t *testing.T) {
+	server := newFakeServer(t)
+	server.PutStatementError("SELECT `T2Id` FROM `t2`", status.Error(codes.PermissionDenied, "permission denied"))
+
+	out := &bytes.Buffer{}
+	dumper := newFakeDumper(t, server, Options{Out: out})
+	err := dumper.DumpTables(context.Background())
+	if spanner.ErrCode(err) != codes.PermissionDenied {
+		t.Errorf("DumpTables() = %v, want PermissionDenied error", err)
+	}
+
+	var incomplete *IncompleteError
+	if !errors.As(err, &incomplete) {
+		t.Fatalf("DumpTables() = %v, want IncompleteError", err)
+	}
+	if want := []string{"t1"}; !reflect.DeepEqual(incomplete.Completed, want) || incomplete.Table != "t2" {
+		t.Errorf("DumpTables() = %+v, want completed tables %v and failed table t2", incomplete, want)
+	}
+	want := "INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (1, \"foo\", [\"a\", \"b\"]), (2, NULL, NULL), (3, \"bar\", []);\n"
+	if got := out.String(); got != want {
+		t.Errorf("DumpTables() wrote %q, want = %q", got, want)
+	}
+}
+
+func TestDumpTablesWithFakeServer_Retry(t *testing.T) {
+	const (
+		query       = "SELECT `Id`, `Name`, `Tags` FROM `t1` ORDER BY `Id`"
+		resumeQuery = "SELECT `Id`, `Name`, `Tags` FROM `t1` WHERE (`Id` > @key0) ORDER BY `Id`"
+	)
+	aborted := status.Error(codes.Aborted, "stream aborted")
+
+	for _, tt := range []struct {
+		desc        string
+		err         error
+		resumeErr   error
+		wantErr     bool
+		wantQueries []string
+	}{
+		{
+			desc:        "resumed after the last key",
+			err:         aborted,
+			wantQueries: []string{query, resumeQuery},
+		},
+		{
+			desc:        "retries exhausted",
+			err:         aborted,
+			resumeErr:   status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			wantErr:     true,
+			wantQueries: []string{query, resumeQuery},
+		},
+		{
+			desc:        "not retryable",
+			err:         status.Error(codes.PermissionDenied, "permission denied"),
+			wantErr:     true,
+			wantQueries: []string{query},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			server := newFakeServer(t)
+			server.PutStatementStreamError(query, 2, tt.err)
+			server.PutStatementResult(resumeQuery, fakespanner.NewResultSet(fakeTables[0].columns, fakeTables[0].rows[2]))
+			if tt.resumeErr != nil {
+				server.PutStatementStreamError(resumeQuery, 0, tt.resumeErr)
+			}
+
+			out, warnings := &bytes.Buffer{}, &bytes.Buffer{}
+			dumper := newFakeDumper(t, server, Options{
+				Out:          out,
+				Tables:       []string{"t1"},
+				MaxRetries:   1,
+				RetryBackoff: time.Millisecond,
+				Warnings:     warnings,
+			})
+			err := dumper.DumpTables(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DumpTables() succeeded, want error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("failed to dump tables: %v", err)
+				}
+				want := "INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (1, \"foo\", [\"a\", \"b\"]), (2, NULL, NULL), (3, \"bar\", []);\n"
+				if got := out.String(); got != want {
+					t.Errorf("DumpTables() = %q, want = %q", got, want)
+				}
+				if !strings.Contains(warnings.String(), "Retrying query of table t1 after 2 rows") {
+					t.Errorf("warnings = %q, want a retry of t1", warnings.String())
+				}
+			}
+
+			var queries []string
+			for _, req := range server.ExecutedRequests() {
+				if req.GetRequestOptions().GetRequestTag() != "spanner-dump/t1" {
+					continue
+				}
+				queries = append(queries, req.Sql)
+				if req.Sql == resumeQuery {
+					if got := req.GetParams().GetFields()["key0"].GetStringValue(); got != "2" {
+						t.Errorf("resumed query has key0 = %q, want = %q", got, "2")
+					}
+				}
+			}
+			if !reflect.DeepEqual(queries, tt.wantQueries) {
+				t.Errorf("queries = %q, want = %q", queries, tt.wantQueries)
+			}
+		})
+	}
+}
+
+// TestRestoreWithFakeServer checks the dump can be applied to another database as is.
+func TestRestoreWithFakeServer(t *testing.T) {
+	server := newFakeServer(t)
+
+	out := &bytes.Buffer{}
+	dumpAll(t, newFakeDumper(t, server, Options{Out: out}))
+
+	var ddls, dmls []string
+	for _, stmt := range strings.Split(strings.TrimSuffix(out.String(), ";\n"), ";\n") {
+		if strings.HasPrefix(stmt, "INSERT") {
+			dmls = append(dmls, stmt)
+		} else {
+			ddls = append(ddls, stmt)
+		}
+	}
+
+	ctx := context.Background()
+	restoreDatabasePath := "projects/fake-project/instances/fake-instance/databases/restored"
+	client, adminClient := newFakeClients(t, server, restoreDatabasePath)
+
+	op, err := adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:   restoreDatabasePath,
+		Statements: ddls,
+	})
+	if err != nil {
+		t.Fatalf("failed to apply DDLs: %v", err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Fatalf("failed to apply DDLs: %v", err)
+	}
+	if got := server.DDLs(restoreDatabasePath); !equalStringSlice(got, fakeDDLs) {
+		t.Errorf("restored DDLs = %q, want = %q", got, fakeDDLs)
+	}
+
+	wantDMLs := []string{
+		"INSERT INTO `t1` (`Id`, `Name`, `Tags`) VALUES (1, \"foo\", [\"a\", \"b\"]), (2, NULL, NULL), (3, \"bar\", [])",
+		"INSERT INTO `t2` (`T2Id`) VALUES (1), (2)",
+		"INSERT INTO `t3` (`T2Id`, `T3Id`) VALUES (1, 1)",
+	}
+	if !equalStringSlice(dmls, wantDMLs) {
+		t.Fatalf("dumped DMLs = %q, want = %q", dmls, wantDMLs)
+	}
+	for _, dml := range dmls {
+		if _, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+			_, err := txn.Update(ctx, spanner.NewStatement(dml))
+			return err
+		}); err != nil {
+			t.Fatalf("failed to apply DML %q: %v", dml, err)
+		}
+	}
+
+	// The fake server doesn't interpret DMLs, so the restore is checked by the executed statements.
+	executed := server.ExecutedStatements()
+	if len(executed) < len(wantDMLs) {
+		t.Fatalf("executed statements = %q, want to end with %q", executed, wantDMLs)
+	}
+	if got := executed[len(executed)-len(wantDMLs):]; !equalStringSlice(got, wantDMLs) {
+		t.Errorf("restored DMLs = %q, want = %q", got, wantDMLs)
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/iterator"
+
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+)
+
+// ListDatabases returns IDs of the ready databases in the instance of the options, in alphabetical order.
+// The admin client is created with the connection options, e.g. Endpoint and CredentialsFile.
+func ListDatabases(ctx context.Context, opts Options) ([]string, error) {
+	if opts.Project == "" || opts.Instance == "" {
+		return nil, errors.New("project and instance are required")
+	}
+	clientOpts, err := clientOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	adminClient, err := adminapi.NewDatabaseAdminClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spanner admin client: %v", err)
+	}
+	defer adminClient.Close()
+	return ListDatabasesWithClient(ctx, adminClient, opts.Project, opts.Instance)
+}
+
+// ListDatabasesWithClient returns IDs of the ready databases in the instance, in alphabetical order.
+// Databases which are being created or restored are omitted, as they can't be read yet.
+func ListDatabasesWithClient(ctx context.Context, adminClient *adminapi.DatabaseAdminClient, project, instance string) ([]string, error) {
+	parent := fmt.Sprintf("projects/%s/instances/%s", project, instance)
+	iter := adminClient.ListDatabases(ctx, &adminpb.ListDatabasesRequest{Parent: parent})
+	var databases []string
+	for {
+		db, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+		if db.State != adminpb.Database_READY && db.State != adminpb.Database_READY_OPTIMIZING {
+			continue
+		}
+		databases = append(databases, strings.TrimPrefix(db.Name, parent+"/databases/"))
+	}
+	sort.Strings(databases)
+	return databases, nil
+}
@@ -14,7 +14,7 @@
 // limitations under the License.
 //
 
-package main
+package dump
 
 import (
 	"bytes"
@@ -31,7 +31,7 @@ import (
 	"google.golang.org/grpc"
 
 	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
-	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
 )
 
 const (
@@ -184,7 +184,13 @@ func TestDump(t *testing.T) {
 	defer tearDown()
 
 	out := &bytes.Buffer{}
-	dumper, err := NewDumper(ctx, testProjectId, testInstanceId, databaseId, out, nil, 1, nil)
+	dumper, err := NewDumper(ctx, Options{
+		Project:  testProjectId,
+		Instance: testInstanceId,
+		Database: databaseId,
+		Out:      out,
+		BulkSize: 1,
+	})
 	if err != nil {
 		t.Fatalf("failed to create dumper: %v", err)
 	}
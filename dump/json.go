@@ -0,0 +1,95 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/spanner"
+)
+
+// FormatJSON is the output format of JSON Lines.
+const FormatJSON = "json"
+
+// JSONEncoder is a RowEncoder to write records as JSON Lines.
+//
+// Each row is written as a JSON object like {"table":"Singers","row":{"SingerId":"1","Name":"Alice"}}.
+// Values are written in the Spanner wire format, e.g. INT64 is a string and BYTES is base64-encoded.
+type JSONEncoder struct {
+	out io.Writer
+	// prefix is a pre-encoded `{"table":"...","row":` part for the current table.
+	prefix []byte
+	keys   [][]byte
+}
+
+// NewJSONEncoder creates JSONEncoder.
+func NewJSONEncoder(out io.Writer, opts EncoderOptions) RowEncoder {
+	return &JSONEncoder{out: out}
+}
+
+// BeginTable implements RowEncoder.
+func (e *JSONEncoder) BeginTable(table *Table) error {
+	name, err := json.Marshal(table.Name)
+	if err != nil {
+		return err
+	}
+	e.prefix = []byte(`{"table":` + string(name) + `,"row":`)
+	e.keys = make([][]byte, len(table.Columns))
+	for i, c := range table.Columns {
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return err
+		}
+		e.keys[i] = key
+	}
+	return nil
+}
+
+// WriteRow implements RowEncoder.
+func (e *JSONEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	// Object keys are written manually to keep the column order.
+	var buf bytes.Buffer
+	buf.Write(e.prefix)
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e.keys[i])
+		buf.WriteByte(':')
+		b, err := json.Marshal(v.Value.AsInterface())
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	buf.WriteString("}}\n")
+	_, err := e.out.Write(buf.Bytes())
+	return err
+}
+
+// EndTable implements RowEncoder.
+func (e *JSONEncoder) EndTable() error {
+	return nil
+}
+
+// Finish implements RowEncoder.
+func (e *JSONEncoder) Finish() error {
+	return nil
+}
@@ -0,0 +1,85 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Statuses of a dump recorded in manifests.
+const (
+	StatusComplete   = "complete"
+	StatusIncomplete = "incomplete" // the dump was interrupted or failed, and some tables are missing or truncated
+)
+
+// Manifest is a record of a dump, which is used to verify the dump later.
+// Status is empty in manifests written before statuses were recorded, which are complete.
+//
+// UnsupportedTypes and DatabaseRole are Options.UnsupportedTypes and Options.DatabaseRole of the dump,
+// which decide the columns of the tables that are dumped.
+type Manifest struct {
+	Database         string          `json:"database"`
+	ReadTimestamp    time.Time       `json:"read_timestamp"`
+	Tables           []TableChecksum `json:"tables"`
+	UnsupportedTypes string          `json:"unsupported_types,omitempty"`
+	DatabaseRole     string          `json:"database_role,omitempty"`
+	Status           string          `json:"status,omitempty"`
+	Error            string          `json:"error,omitempty"`
+}
+
+// InstanceManifest is a record of a dump of multiple databases in an instance,
+// each of which is dumped into its own directory with its Manifest.
+type InstanceManifest struct {
+	Instance  string             `json:"instance"`
+	Databases []DatabaseManifest `json:"databases"`
+}
+
+// DatabaseManifest is a record of a database in InstanceManifest.
+// Error is the reason of the failure if the database couldn't be dumped completely.
+type DatabaseManifest struct {
+	Database      string     `json:"database"`
+	Dir           string     `json:"dir"`
+	ReadTimestamp *time.Time `json:"read_timestamp,omitempty"`
+	Tables        int        `json:"tables"`
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// Write writes the instance manifest in JSON.
+func (m *InstanceManifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// ReadManifest reads a manifest written by Manifest.Write.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Write writes the manifest in JSON.
+func (m *Manifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
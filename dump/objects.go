@@ -0,0 +1,110 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Object types of DDL statements, which can be given to Options.Objects.
+const (
+	ObjectTables          = "tables"           // tables, indexes and foreign keys
+	ObjectViews           = "views"            // views
+	ObjectChangeStreams   = "change-streams"   // change streams
+	ObjectSequences       = "sequences"        // sequences
+	ObjectRoles           = "roles"            // roles and grants
+	ObjectSchemas         = "schemas"          // named schemas
+	ObjectModels          = "models"           // ML models
+	ObjectFunctions       = "functions"        // user-defined functions
+	ObjectProtoBundles    = "proto-bundles"    // proto bundles
+	ObjectDatabaseOptions = "database-options" // ALTER DATABASE statements
+)
+
+// ObjectTypes returns all object types of DDL statements.
+func ObjectTypes() []string {
+	return []string{
+		ObjectTables, ObjectViews, ObjectChangeStreams, ObjectSequences, ObjectRoles,
+		ObjectSchemas, ObjectModels, ObjectFunctions, ObjectProtoBundles, ObjectDatabaseOptions,
+	}
+}
+
+// objectTypesOfKinds maps kinds of objects defined or altered by DDL statements to object types.
+var objectTypesOfKinds = map[string]string{
+	"TABLE":         ObjectTables,
+	"INDEX":         ObjectTables,
+	"SEARCH INDEX":  ObjectTables,
+	"VECTOR INDEX":  ObjectTables,
+	"CONSTRAINT":    ObjectTables,
+	"VIEW":          ObjectViews,
+	"CHANGE STREAM": ObjectChangeStreams,
+	"SEQUENCE":      ObjectSequences,
+	"ROLE":          ObjectRoles,
+	"SCHEMA":        ObjectSchemas,
+	"MODEL":         ObjectModels,
+	"FUNCTION":      ObjectFunctions,
+	"PROTO BUNDLE":  ObjectProtoBundles,
+	"DATABASE":      ObjectDatabaseOptions,
+}
+
+// newObjectTypes validates object types and returns them as a set. If no types are given, it returns nil.
+func newObjectTypes(types []string) (map[string]bool, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	valid := map[string]bool{}
+	for _, t := range ObjectTypes() {
+		valid[t] = true
+	}
+	set := map[string]bool{}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if !valid[t] {
+			return nil, fmt.Errorf("unknown object type: %q, must be one of %s", t, strings.Join(ObjectTypes(), ", "))
+		}
+		set[t] = true
+	}
+	return set, nil
+}
+
+// objectType returns the object type of the statement, or an empty string for an unknown statement.
+func (obj *ddlStatement) objectType() string {
+	switch {
+	case obj.kind != "":
+		return objectTypesOfKinds[obj.kind]
+	case obj.tokens[0].isKeyword("GRANT") || obj.tokens[0].isKeyword("REVOKE"):
+		return ObjectRoles
+	case obj.tokens[0].isKeyword("ALTER"):
+		// e.g. ALTER TABLE t ADD COLUMN ..., ALTER CHANGE STREAM cs SET FOR ...
+		kind, _ := parseObjectKind(obj.tokens, 1)
+		return objectTypesOfKinds[kind]
+	default:
+		return ""
+	}
+}
+
+// filterObjectTypes returns statements of the given object types.
+// Statements of unknown types are excluded.
+func filterObjectTypes(stmts []*ddlStatement, types map[string]bool) []*ddlStatement {
+	var filtered []*ddlStatement
+	for _, s := range stmts {
+		if types[s.objectType()] {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,229 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// progressInterval is the minimum interval of updating the status line.
+const progressInterval = time.Second
+
+// ByteCounter is an io.Writer which counts the bytes written to the underlying writer.
+type ByteCounter struct {
+	w io.Writer
+	n int64
+}
+
+// NewByteCounter creates ByteCounter which writes to w.
+func NewByteCounter(w io.Writer) *ByteCounter {
+	return &ByteCounter{w: w}
+}
+
+// Write implements io.Writer.
+func (c *ByteCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far.
+func (c *ByteCounter) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// countRows counts rows of the tables to estimate the progress of the dump.
+func (d *Dumper) countRows(ctx context.Context, txn *spanner.ReadOnlyTransaction, tables []*Table) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, t := range tables {
+		stmt := spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) FROM `%s`", t.Name))
+		var n int64
+		if err := txn.QueryWithOptions(ctx, stmt, d.queryOptions(t.Name+"/count")).Do(func(r *spanner.Row) error {
+			return r.Column(0, &n)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %v", t.Name, err)
+		}
+		counts[t.Name] = n
+	}
+	return counts, nil
+}
+
+// progressEncoder is a RowEncoder which reports the progress of the underlying encoder.
+//
+// A status line with row counts, bytes written, rows/sec and ETA is updated in place by carriage returns,
+// and a line is left for each table when it's done.
+type progressEncoder struct {
+	encoder      RowEncoder
+	out          io.Writer
+	bytesWritten func() int64
+	now          func() time.Time
+
+	// counts are the estimated numbers of rows of tables, and totalRows is their sum.
+	counts    map[string]int64
+	totalRows int64
+
+	start      time.Time
+	lastReport time.Time
+	lineLen    int
+
+	table      string
+	tableStart time.Time
+	tableRows  int64
+	rows       int64
+}
+
+func newProgressEncoder(encoder RowEncoder, out io.Writer, bytesWritten func() int64, counts map[string]int64) *progressEncoder {
+	e := &progressEncoder{
+		encoder:      encoder,
+		out:          out,
+		bytesWritten: bytesWritten,
+		now:          time.Now,
+		counts:       counts,
+	}
+	for _, n := range counts {
+		e.totalRows += n
+	}
+	return e
+}
+
+// BeginTable implements RowEncoder.
+func (e *progressEncoder) BeginTable(table *Table) error {
+	now := e.now()
+	if e.start.IsZero() {
+		e.start = now
+	}
+	e.table = table.Name
+	e.tableStart = now
+	e.tableRows = 0
+	e.report(now)
+	return e.encoder.BeginTable(table)
+}
+
+// WriteRow implements RowEncoder.
+func (e *progressEncoder) WriteRow(values []spanner.GenericColumnValue) error {
+	if err := e.encoder.WriteRow(values); err != nil {
+		return err
+	}
+	e.rows++
+	e.tableRows++
+	if now := e.now(); now.Sub(e.lastReport) >= progressInterval {
+		e.report(now)
+	}
+	return nil
+}
+
+// EndTable implements RowEncoder.
+func (e *progressEncoder) EndTable() error {
+	if err := e.encoder.EndTable(); err != nil {
+		return err
+	}
+	e.printLine(fmt.Sprintf("%s: %d rows in %s", e.table, e.tableRows, formatDuration(e.now().Sub(e.tableStart))), true)
+	return nil
+}
+
+// Finish implements RowEncoder.
+func (e *progressEncoder) Finish() error {
+	if err := e.encoder.Finish(); err != nil {
+		return err
+	}
+	elapsed := time.Duration(0)
+	if !e.start.IsZero() {
+		elapsed = e.now().Sub(e.start)
+	}
+	e.printLine(fmt.Sprintf("Dumped %d rows, %s in %s", e.rows, e.bytes(), formatDuration(elapsed)), true)
+	return nil
+}
+
+// report updates the status line.
+func (e *progressEncoder) report(now time.Time) {
+	e.lastReport = now
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d", e.table, e.tableRows)
+	if n, ok := e.counts[e.table]; ok {
+		fmt.Fprintf(&sb, "/%d", n)
+	}
+	fmt.Fprintf(&sb, " rows | total %d", e.rows)
+	if e.totalRows > 0 {
+		fmt.Fprintf(&sb, "/%d rows (%d%%)", e.totalRows, e.rows*100/e.totalRows)
+	} else {
+		sb.WriteString(" rows")
+	}
+
+	elapsed := now.Sub(e.start)
+	fmt.Fprintf(&sb, ", %s", e.bytes())
+	if elapsed > 0 {
+		rate := float64(e.rows) / elapsed.Seconds()
+		fmt.Fprintf(&sb, ", %.0f rows/s", rate)
+		if rate > 0 && e.totalRows > e.rows {
+			eta := time.Duration(float64(e.totalRows-e.rows) / rate * float64(time.Second))
+			fmt.Fprintf(&sb, ", ETA %s", formatDuration(eta))
+		}
+	}
+	e.printLine(sb.String(), false)
+}
+
+// printLine overwrites the status line with the text. If done is true, the line is terminated by a newline.
+func (e *progressEncoder) printLine(s string, done bool) {
+	padding := ""
+	if len(s) < e.lineLen {
+		padding = strings.Repeat(" ", e.lineLen-len(s))
+	}
+	end := ""
+	e.lineLen = len(s)
+	if done {
+		end = "\n"
+		e.lineLen = 0
+	}
+	fmt.Fprintf(e.out, "\r%s%s%s", s, padding, end)
+}
+
+func (e *progressEncoder) bytes() string {
+	if e.bytesWritten == nil {
+		return "- bytes"
+	}
+	return formatBytes(e.bytesWritten())
+}
+
+// formatBytes formats the number of bytes in binary units, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// formatDuration formats the duration rounded to seconds, or to milliseconds if it's shorter than a second.
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestProgressEncoder(t *testing.T) {
+	out, data := &bytes.Buffer{}, &bytes.Buffer{}
+	counter := NewByteCounter(data)
+	e := newProgressEncoder(NewCSVEncoder(counter, EncoderOptions{}), out, counter.Count, map[string]int64{"t1": 4})
+	now := time.Date(2020, 1, 23, 3, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	table := &Table{Name: "t1", Columns: []Column{{Name: "Id"}}}
+	if err := e.BeginTable(table); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Second)
+		if err := e.WriteRow([]spanner.GenericColumnValue{createColumnValue(t, int64(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.EndTable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bytes are counted when the encoder flushes its buffer.
+	want := "\rt1: 0/4 rows | total 0/4 rows (0%), 0 B" +
+		"\rt1: 1/4 rows | total 1/4 rows (25%), 0 B, 1 rows/s, ETA 3s" +
+		"\rt1: 2/4 rows | total 2/4 rows (50%), 0 B, 1 rows/s, ETA 2s" +
+		"\rt1: 2 rows in 2s                                          \n" +
+		"\rDumped 2 rows, 7 B in 2s\n"
+	if got := out.String(); got != want {
+		t.Errorf("progress = %q, want = %q", got, want)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, tt := range []struct {
+		n    int64
+		want string
+	}{
+		{n: 0, want: "0 B"},
+		{n: 1023, want: "1023 B"},
+		{n: 1536, want: "1.5 KiB"},
+		{n: 5 << 20, want: "5.0 MiB"},
+		{n: 3 << 30, want: "3.0 GiB"},
+	} {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want = %q", tt.n, got, tt.want)
+		}
+	}
+}
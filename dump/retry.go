@@ -0,0 +1,135 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// writeTableRows writes all rows of the table read in the transaction to the encoder, and returns the number of rows
+// with the query statistics.
+//
+// If Options.MaxRetries is set, the table is read in primary key order, and the query is resumed after the last
+// written row when it fails with a retryable error. The query statistics are those of the last query in that case.
+func (d *Dumper) writeTableRows(ctx context.Context, table *Table, txn *spanner.ReadOnlyTransaction, opts spanner.QueryOptions, encoder RowEncoder) (int64, map[string]interface{}, error) {
+	keyIndex := primaryKeyIndex(table)
+	if d.maxRetries == 0 || len(keyIndex) == 0 || len(keyIndex) != len(table.PrimaryKeys) {
+		// Queries can't be resumed without all primary key columns, e.g. generated ones, which are not dumped.
+		iter := queryTable(ctx, table, txn, false, opts)
+		defer iter.Stop()
+		rows, err := writeRows([]*spanner.RowIterator{iter}, encoder, nil)
+		return rows, iter.QueryStats, err
+	}
+
+	var rows int64
+	var lastKey []spanner.GenericColumnValue
+	written := func(values []spanner.GenericColumnValue) {
+		lastKey = make([]spanner.GenericColumnValue, len(keyIndex))
+		for i, idx := range keyIndex {
+			lastKey[i] = values[idx]
+		}
+	}
+	backoff := d.retryBackoff
+	for retries := uint(0); ; retries++ {
+		iter := txn.QueryWithOptions(ctx, resumeQuery(table, lastKey), opts)
+		n, err := writeRows([]*spanner.RowIterator{iter}, encoder, written)
+		iter.Stop()
+		rows += n
+		if err == nil {
+			return rows, iter.QueryStats, nil
+		}
+		if retries >= d.maxRetries || !isRetryable(ctx, err) {
+			return rows, iter.QueryStats, err
+		}
+
+		d.warnf("Retrying query of table %s after %d rows in %s: %v\n", table.Name, rows, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return rows, iter.QueryStats, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// isRetryable returns true if the query of a table which failed with err can be retried.
+// Errors of the context, e.g. its own deadline, are not retryable.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch spanner.ErrCode(err) {
+	case codes.Aborted, codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// resumeQuery returns the statement to query rows of the table after lastKey in primary key order.
+// If lastKey is nil, it queries all rows of the table.
+//
+// As tuples can't be compared, (k1, k2) > (v1, v2) is expanded to (k1 > v1) OR (k1 = v1 AND k2 > v2).
+// NULL is the smallest value in ascending order, so "k > NULL" is "k IS NOT NULL".
+func resumeQuery(table *Table, lastKey []spanner.GenericColumnValue) spanner.Statement {
+	if lastKey == nil {
+		return tableQuery(table, true)
+	}
+
+	params := map[string]interface{}{}
+	var conds []string
+	for i := range table.PrimaryKeys {
+		var terms []string
+		for j := 0; j <= i; j++ {
+			column := fmt.Sprintf("`%s`", table.PrimaryKeys[j])
+			param := fmt.Sprintf("key%d", j)
+			isNull := isNullValue(lastKey[j])
+			if !isNull {
+				params[param] = lastKey[j]
+			}
+			switch {
+			case j < i && isNull:
+				terms = append(terms, column+" IS NULL")
+			case j < i:
+				terms = append(terms, fmt.Sprintf("%s = @%s", column, param))
+			case isNull:
+				terms = append(terms, column+" IS NOT NULL")
+			default:
+				terms = append(terms, fmt.Sprintf("%s > @%s", column, param))
+			}
+		}
+		conds = append(conds, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM `%s` WHERE %s ORDER BY %s",
+		table.selectList(), table.Name, strings.Join(conds, " OR "), table.quotedPrimaryKeyList())
+	return spanner.Statement{SQL: sql, Params: params}
+}
+
+func isNullValue(v spanner.GenericColumnValue) bool {
+	_, ok := v.Value.GetKind().(*structpb.Value_NullValue)
+	return ok
+}
@@ -0,0 +1,85 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestResumeQuery(t *testing.T) {
+	intValue := func(s string) spanner.GenericColumnValue {
+		return spanner.GenericColumnValue{Type: &sppb.Type{Code: sppb.TypeCode_INT64}, Value: structpb.NewStringValue(s)}
+	}
+	null := spanner.GenericColumnValue{Type: &sppb.Type{Code: sppb.TypeCode_STRING}, Value: structpb.NewNullValue()}
+
+	for _, tt := range []struct {
+		desc       string
+		table      *Table
+		lastKey    []spanner.GenericColumnValue
+		wantSQL    string
+		wantParams []string
+	}{
+		{
+			desc:    "first query",
+			table:   &Table{Name: "t1", Columns: []Column{{Name: "Id"}, {Name: "Name"}}, PrimaryKeys: []string{"Id"}},
+			wantSQL: "SELECT `Id`, `Name` FROM `t1` ORDER BY `Id`",
+		},
+		{
+			desc:       "single key",
+			table:      &Table{Name: "t1", Columns: []Column{{Name: "Id"}, {Name: "Name"}}, PrimaryKeys: []string{"Id"}},
+			lastKey:    []spanner.GenericColumnValue{intValue("2")},
+			wantSQL:    "SELECT `Id`, `Name` FROM `t1` WHERE (`Id` > @key0) ORDER BY `Id`",
+			wantParams: []string{"key0"},
+		},
+		{
+			desc:       "composite key",
+			table:      &Table{Name: "t3", Columns: []Column{{Name: "T2Id"}, {Name: "T3Id"}}, PrimaryKeys: []string{"T2Id", "T3Id"}},
+			lastKey:    []spanner.GenericColumnValue{intValue("1"), intValue("5")},
+			wantSQL:    "SELECT `T2Id`, `T3Id` FROM `t3` WHERE (`T2Id` > @key0) OR (`T2Id` = @key0 AND `T3Id` > @key1) ORDER BY `T2Id`, `T3Id`",
+			wantParams: []string{"key0", "key1"},
+		},
+		{
+			desc:       "null key",
+			table:      &Table{Name: "t4", Columns: []Column{{Name: "Name"}, {Name: "Id"}}, PrimaryKeys: []string{"Name", "Id"}},
+			lastKey:    []spanner.GenericColumnValue{null, intValue("3")},
+			wantSQL:    "SELECT `Name`, `Id` FROM `t4` WHERE (`Name` IS NOT NULL) OR (`Name` IS NULL AND `Id` > @key1) ORDER BY `Name`, `Id`",
+			wantParams: []string{"key1"},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := resumeQuery(tt.table, tt.lastKey)
+			if got.SQL != tt.wantSQL {
+				t.Errorf("resumeQuery() = %q, want = %q", got.SQL, tt.wantSQL)
+			}
+			var params []string
+			for k := range got.Params {
+				params = append(params, k)
+			}
+			sort.Strings(params)
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("resumeQuery() has params %v, want = %v", params, tt.wantParams)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaChange is a step to migrate a schema into another.
+type SchemaChange struct {
+	// DDL is a DDL statement without a trailing semicolon. It's empty if the change can't be done by DDL.
+	DDL string
+	// Comment explains a destructive change or a change which can't be done automatically.
+	Comment string
+}
+
+// String returns the change as SQL text, with the comment as a SQL comment.
+func (c SchemaChange) String() string {
+	var sb strings.Builder
+	if c.Comment != "" {
+		fmt.Fprintf(&sb, "-- %s\n", c.Comment)
+	}
+	if c.DDL != "" {
+		fmt.Fprintf(&sb, "%s;\n", c.DDL)
+	}
+	return sb.String()
+}
+
+// dropStatement returns a DDL statement to drop the object, or an empty string if it can't be dropped.
+func (obj *ddlStatement) dropStatement() string {
+	switch obj.kind {
+	case "":
+		if obj.tokens[0].isKeyword("GRANT") {
+			return revokeStatement(obj)
+		}
+		return ""
+	case "DATABASE":
+		return ""
+	case "CONSTRAINT":
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", obj.table, obj.name)
+	case "PROTO BUNDLE":
+		return "DROP PROTO BUNDLE"
+	default:
+		return fmt.Sprintf("DROP %s %s", obj.kind, obj.name)
+	}
+}
+
+// revokeStatement converts GRANT ... TO ... into REVOKE ... FROM ....
+func revokeStatement(obj *ddlStatement) string {
+	to := -1
+	for i, t := range obj.tokens {
+		if t.isKeyword("TO") {
+			to = i
+		}
+	}
+	if to < 0 {
+		return ""
+	}
+	return "REVOKE " + tokensText(obj.text, obj.tokens[1:to]) + " FROM " + tokensText(obj.text, obj.tokens[to+1:])
+}
+
+// SchemaDiff compares two schemas given as DDL statements, and returns changes to migrate the schema from into to.
+//
+// Tables are altered by adding, dropping and altering columns and constraints where possible.
+// Tables whose primary key or parent is changed are dropped and recreated, which loses their data,
+// together with their indexes, constraints and interleaved tables.
+// Views are replaced, and other changed objects are dropped and recreated.
+//
+// Statements are ordered so that objects are dropped in the reverse order of from,
+// and created or altered in the order of to, which is valid if both schemas are in the order of GetDatabaseDdl.
+func SchemaDiff(from, to []string) ([]SchemaChange, error) {
+	fromObjs, err := parseDDLs(from)
+	if err != nil {
+		return nil, err
+	}
+	toObjs, err := parseDDLs(to)
+	if err != nil {
+		return nil, err
+	}
+	toByKey := map[string]*ddlStatement{}
+	for _, obj := range toObjs {
+		toByKey[obj.key] = obj
+	}
+
+	// Find tables to recreate, including their interleaved tables.
+	recreated := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, obj := range fromObjs {
+			if obj.kind != "TABLE" || recreated[obj.key] {
+				continue
+			}
+			newObj, ok := toByKey[obj.key]
+			if !ok {
+				continue
+			}
+			if obj.primaryKey != newObj.primaryKey || (obj.parent != "" && recreated[tableKey(obj.parent)]) {
+				recreated[obj.key] = true
+				changed = true
+			}
+		}
+	}
+	// dropped is true for objects which are dropped and created again.
+	dropped := map[string]bool{}
+	var changes []SchemaChange
+	for i := len(fromObjs) - 1; i >= 0; i-- {
+		obj := fromObjs[i]
+		newObj, ok := toByKey[obj.key]
+		switch {
+		case !ok:
+		case recreated[obj.key]:
+			dropped[obj.key] = true
+			changes = append(changes, SchemaChange{
+				DDL:     obj.dropStatement(),
+				Comment: fmt.Sprintf("Table %s is recreated as its primary key or parent is changed. Data in the table will be lost.", obj.name),
+			})
+			continue
+		case obj.table != "" && recreated[tableKey(obj.table)]:
+		case obj.normalized == newObj.normalized, obj.kind == "TABLE", obj.kind == "VIEW", obj.kind == "DATABASE":
+			continue
+		}
+		dropped[obj.key] = true
+		ddl := obj.dropStatement()
+		if ddl == "" {
+			changes = append(changes, SchemaChange{Comment: "Unable to revert: " + oneLine(obj.text)})
+			continue
+		}
+		changes = append(changes, SchemaChange{DDL: ddl})
+	}
+
+	fromByKey := map[string]*ddlStatement{}
+	for _, obj := range fromObjs {
+		fromByKey[obj.key] = obj
+	}
+	for _, newObj := range toObjs {
+		obj, ok := fromByKey[newObj.key]
+		switch {
+		case !ok || dropped[newObj.key]:
+			changes = append(changes, SchemaChange{DDL: newObj.text})
+		case obj.normalized == newObj.normalized:
+		case newObj.kind == "TABLE":
+			changes = append(changes, alterTable(obj, newObj)...)
+		case newObj.kind == "VIEW":
+			changes = append(changes, SchemaChange{DDL: createOrReplace(newObj)})
+		case newObj.kind == "DATABASE":
+			changes = append(changes, SchemaChange{DDL: newObj.text})
+		}
+	}
+	return changes, nil
+}
+
+// tableKey returns the key of the table from the original text of its name.
+func tableKey(name string) string {
+	tokens, err := tokenize(name)
+	if err != nil {
+		return ""
+	}
+	return "TABLE " + strings.ToUpper(nameValue(tokens))
+}
+
+// createOrReplace returns CREATE OR REPLACE statement of the view.
+func createOrReplace(obj *ddlStatement) string {
+	if obj.tokens[1].isKeyword("OR") {
+		return obj.text
+	}
+	return "CREATE OR REPLACE" + obj.text[obj.tokens[0].end:]
+}
+
+// alterTable returns changes to alter columns, constraints and the row deletion policy of the table.
+func alterTable(from, to *ddlStatement) []SchemaChange {
+	var changes []SchemaChange
+	alter := func(format string, args ...interface{}) {
+		changes = append(changes, SchemaChange{DDL: fmt.Sprintf("ALTER TABLE %s ", to.name) + fmt.Sprintf(format, args...)})
+	}
+
+	fromConstraints, toConstraints := elementsByKey(from.constraints), elementsByKey(to.constraints)
+	for _, c := range from.constraints {
+		if newC, ok := toConstraints[c.key]; ok && newC.normalized == c.normalized {
+			continue
+		}
+		if c.name == "" {
+			changes = append(changes, SchemaChange{Comment: fmt.Sprintf("Unable to drop an unnamed constraint of %s: %s", to.name, oneLine(tokensText(from.text, c.tokens)))})
+			continue
+		}
+		alter("DROP CONSTRAINT %s", c.name)
+	}
+
+	toColumns := elementsByKey(to.columns)
+	for _, c := range from.columns {
+		newC, ok := toColumns[c.key]
+		if !ok {
+			alter("DROP COLUMN %s", c.name)
+			continue
+		}
+		if newC.normalized == c.normalized {
+			continue
+		}
+		oldDef, oldOptions := splitColumnOptions(c.tokens)
+		newDef, newOptions := splitColumnOptions(newC.tokens)
+		if normalizeTokens(oldDef) != normalizeTokens(newDef) {
+			if isGeneratedColumn(oldDef) || isGeneratedColumn(newDef) {
+				changes = append(changes, SchemaChange{
+					DDL:     fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", to.name, c.name),
+					Comment: fmt.Sprintf("Generated column %s.%s can't be altered and is recreated.", to.name, newC.name),
+				})
+				alter("ADD COLUMN %s", tokensText(to.text, newC.tokens))
+				continue
+			}
+			alter("ALTER COLUMN %s", tokensText(to.text, newDef))
+		}
+		if normalizeTokens(oldOptions) != normalizeTokens(newOptions) {
+			if len(newOptions) == 0 {
+				alter("ALTER COLUMN %s SET OPTIONS (allow_commit_timestamp = null)", newC.name)
+			} else {
+				alter("ALTER COLUMN %s SET %s", newC.name, tokensText(to.text, newOptions))
+			}
+		}
+	}
+	fromColumns := elementsByKey(from.columns)
+	for _, c := range to.columns {
+		if _, ok := fromColumns[c.key]; !ok {
+			alter("ADD COLUMN %s", tokensText(to.text, c.tokens))
+		}
+	}
+
+	for _, c := range to.constraints {
+		if oldC, ok := fromConstraints[c.key]; ok && oldC.normalized == c.normalized {
+			continue
+		}
+		alter("ADD %s", tokensText(to.text, c.tokens))
+	}
+
+	if normalizeTokens(from.rowDeletionPolicy) != normalizeTokens(to.rowDeletionPolicy) {
+		switch {
+		case len(to.rowDeletionPolicy) == 0:
+			alter("DROP ROW DELETION POLICY")
+		case len(from.rowDeletionPolicy) == 0:
+			alter("ADD %s", tokensText(to.text, to.rowDeletionPolicy))
+		default:
+			alter("REPLACE %s", tokensText(to.text, to.rowDeletionPolicy))
+		}
+	}
+	return changes
+}
+
+func elementsByKey(elems []tableElement) map[string]tableElement {
+	m := map[string]tableElement{}
+	for _, e := range elems {
+		m[e.key] = e
+	}
+	return m
+}
+
+// splitColumnOptions splits a column definition into the definition and the OPTIONS clause.
+func splitColumnOptions(tokens []token) ([]token, []token) {
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].isKeyword("OPTIONS") && i+1 < len(tokens) && tokens[i+1].isSymbol("(") {
+			return tokens[:i], tokens[i:]
+		}
+	}
+	return tokens, nil
+}
+
+// isGeneratedColumn returns true if the column definition has AS (expression).
+func isGeneratedColumn(tokens []token) bool {
+	for i := 1; i+1 < len(tokens); i++ {
+		if tokens[i].isKeyword("AS") && tokens[i+1].isSymbol("(") {
+			return true
+		}
+	}
+	return false
+}
+
+// oneLine joins the lines of the text to embed it in a comment.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
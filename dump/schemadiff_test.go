@@ -0,0 +1,152 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	sql := "-- header\nCREATE TABLE t1 (\n  Id INT64 NOT NULL, -- comment; not a separator\n  S STRING(MAX) DEFAULT (\"a;b\"),\n) PRIMARY KEY(Id);\n/* block; comment */\nCREATE INDEX `idx;1` ON t1(S);\n\n;CREATE VIEW v SQL SECURITY INVOKER AS SELECT 1"
+	want := []string{
+		"CREATE TABLE t1 (\n  Id INT64 NOT NULL, -- comment; not a separator\n  S STRING(MAX) DEFAULT (\"a;b\"),\n) PRIMARY KEY(Id)",
+		"CREATE INDEX `idx;1` ON t1(S)",
+		"CREATE VIEW v SQL SECURITY INVOKER AS SELECT 1",
+	}
+	got, err := SplitStatements(sql)
+	if err != nil {
+		t.Fatalf("SplitStatements() failed unexpectedly: %v", err)
+	}
+	if !equalStringSlice(got, want) {
+		t.Errorf("SplitStatements() = %q, want = %q", got, want)
+	}
+
+	if _, err := SplitStatements("SELECT 'unclosed"); err == nil {
+		t.Errorf("SplitStatements() succeeded unexpectedly for an unclosed string")
+	}
+}
+
+func TestSchemaDiff(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		from, to []string
+		want     []string
+	}{
+		{
+			desc: "same schema with different formatting",
+			from: []string{"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)"},
+			to:   []string{"create table `T1` (Id int64 not null) primary key (Id)"},
+			want: []string{},
+		},
+		{
+			desc: "new and dropped objects",
+			from: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE TABLE t2 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE INDEX t2_Id ON t2(Id)",
+				"GRANT SELECT ON TABLE t2 TO ROLE r",
+			},
+			to: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE TABLE t3 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE SEARCH INDEX t3_Search ON t3(Id)",
+			},
+			want: []string{
+				"REVOKE SELECT ON TABLE t2 FROM ROLE r;\n",
+				"DROP INDEX t2_Id;\n",
+				"DROP TABLE t2;\n",
+				"CREATE TABLE t3 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id);\n",
+				"CREATE SEARCH INDEX t3_Search ON t3(Id);\n",
+			},
+		},
+		{
+			desc: "altered columns and constraints",
+			from: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  A STRING(10),\n  B INT64,\n  C TIMESTAMP OPTIONS (allow_commit_timestamp=true),\n  CONSTRAINT ck CHECK(B > 0),\n) PRIMARY KEY(Id)",
+			},
+			to: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  A STRING(MAX) NOT NULL,\n  C TIMESTAMP,\n  D ARRAY<STRUCT<X INT64, Y STRING(MAX)>>,\n  CONSTRAINT ck CHECK(B > 1),\n) PRIMARY KEY(Id),\n  ROW DELETION POLICY (OLDER_THAN(C, INTERVAL 1 DAY))",
+			},
+			want: []string{
+				"ALTER TABLE t1 DROP CONSTRAINT ck;\n",
+				"ALTER TABLE t1 ALTER COLUMN A STRING(MAX) NOT NULL;\n",
+				"ALTER TABLE t1 DROP COLUMN B;\n",
+				"ALTER TABLE t1 ALTER COLUMN C SET OPTIONS (allow_commit_timestamp = null);\n",
+				"ALTER TABLE t1 ADD COLUMN D ARRAY<STRUCT<X INT64, Y STRING(MAX)>>;\n",
+				"ALTER TABLE t1 ADD CONSTRAINT ck CHECK(B > 1);\n",
+				"ALTER TABLE t1 ADD ROW DELETION POLICY (OLDER_THAN(C, INTERVAL 1 DAY));\n",
+			},
+		},
+		{
+			desc: "recreated table with dependent objects",
+			from: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE TABLE t2 (\n  Id INT64 NOT NULL,\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(Id, T2Id),\n  INTERLEAVE IN PARENT t1 ON DELETE CASCADE",
+				"CREATE INDEX t1_Id ON t1(Id)",
+				"ALTER TABLE t2 ADD CONSTRAINT fk FOREIGN KEY(T2Id) REFERENCES t1(Id)",
+			},
+			to: []string{
+				"CREATE TABLE t1 (\n  Id STRING(MAX) NOT NULL,\n) PRIMARY KEY(Id)",
+				"CREATE TABLE t2 (\n  Id INT64 NOT NULL,\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(Id, T2Id),\n  INTERLEAVE IN PARENT t1 ON DELETE CASCADE",
+				"CREATE INDEX t1_Id ON t1(Id)",
+				"ALTER TABLE t2 ADD CONSTRAINT fk FOREIGN KEY(T2Id) REFERENCES t1(Id)",
+			},
+			want: []string{
+				"ALTER TABLE t2 DROP CONSTRAINT fk;\n",
+				"DROP INDEX t1_Id;\n",
+				"-- Table t2 is recreated as its primary key or parent is changed. Data in the table will be lost.\nDROP TABLE t2;\n",
+				"-- Table t1 is recreated as its primary key or parent is changed. Data in the table will be lost.\nDROP TABLE t1;\n",
+				"CREATE TABLE t1 (\n  Id STRING(MAX) NOT NULL,\n) PRIMARY KEY(Id);\n",
+				"CREATE TABLE t2 (\n  Id INT64 NOT NULL,\n  T2Id INT64 NOT NULL,\n) PRIMARY KEY(Id, T2Id),\n  INTERLEAVE IN PARENT t1 ON DELETE CASCADE;\n",
+				"CREATE INDEX t1_Id ON t1(Id);\n",
+				"ALTER TABLE t2 ADD CONSTRAINT fk FOREIGN KEY(T2Id) REFERENCES t1(Id);\n",
+			},
+		},
+		{
+			desc: "replaced view and recreated index",
+			from: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n) PRIMARY KEY(Id)",
+				"CREATE INDEX t1_Name ON t1(Name)",
+				"CREATE VIEW v SQL SECURITY INVOKER AS SELECT t1.Id FROM t1",
+			},
+			to: []string{
+				"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n  Name STRING(MAX),\n) PRIMARY KEY(Id)",
+				"CREATE UNIQUE INDEX t1_Name ON t1(Name)",
+				"CREATE VIEW v SQL SECURITY INVOKER AS SELECT t1.Name FROM t1",
+			},
+			want: []string{
+				"DROP INDEX t1_Name;\n",
+				"CREATE UNIQUE INDEX t1_Name ON t1(Name);\n",
+				"CREATE OR REPLACE VIEW v SQL SECURITY INVOKER AS SELECT t1.Name FROM t1;\n",
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			changes, err := SchemaDiff(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("SchemaDiff() failed unexpectedly: %v", err)
+			}
+			got := []string{}
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if !equalStringSlice(got, tt.want) {
+				t.Errorf("SchemaDiff() = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Stats is statistics of DumpTables, which is collected if Options.CollectStats is set.
+type Stats struct {
+	Database      string    `json:"database"`
+	ReadTimestamp time.Time `json:"read_timestamp"`
+	// ElapsedSeconds is the time taken by DumpTables.
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// Rows and Bytes are the sums of all tables. Bytes is nil if the size is unknown, as in TableStats.
+	Rows   int64        `json:"rows"`
+	Bytes  *int64       `json:"bytes,omitempty"`
+	Tables []TableStats `json:"tables"`
+}
+
+// TableStats is statistics of dumping a table.
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// Bytes is the size of the table records written by the encoder.
+	// It's nil and omitted in JSON if the size is unknown, i.e. Options.Encoder is set without Options.BytesWritten.
+	Bytes          *int64  `json:"bytes,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// QueryStats is the query statistics returned by Cloud Spanner in the PROFILE mode,
+	// e.g. "elapsed_time", "cpu_time" and "rows_scanned".
+	QueryStats map[string]interface{} `json:"query_stats,omitempty"`
+}
+
+func (s *Stats) addTable(t TableStats) {
+	s.Tables = append(s.Tables, t)
+	s.Rows += t.Rows
+	if t.Bytes != nil {
+		if s.Bytes == nil {
+			s.Bytes = new(int64)
+		}
+		*s.Bytes += *t.Bytes
+	}
+}
+
+// Write writes the stats in JSON.
+func (s *Stats) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Summary returns a one-line summary of the stats. The size is omitted if it's unknown.
+func (s *Stats) Summary() string {
+	size := ""
+	if s.Bytes != nil {
+		size = ", " + formatBytes(*s.Bytes)
+	}
+	return fmt.Sprintf("Dumped %d rows of %d tables%s in %s", s.Rows, len(s.Tables), size,
+		formatDuration(time.Duration(s.ElapsedSeconds*float64(time.Second))))
+}
@@ -0,0 +1,280 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// Table represents a Spanner table.
+type Table struct {
+	Name        string
+	Columns     []Column
+	PrimaryKeys []string
+	ChildTables []*Table
+}
+
+// Column represents a column in a Spanner table.
+type Column struct {
+	Name string
+	// Type is the column type as shown in INFORMATION_SCHEMA.COLUMNS.SPANNER_TYPE, e.g. "STRING(MAX)".
+	Type string
+	// Default is the default value expression as shown in INFORMATION_SCHEMA.COLUMNS.COLUMN_DEFAULT.
+	// It's empty if the column has no default value.
+	Default string
+	// AllowCommitTimestamp is true if the column has the option allow_commit_timestamp=true.
+	AllowCommitTimestamp bool
+
+	// null is true if NULL is read instead of the column value, for a column of an unsupported type.
+	null bool
+}
+
+// supportedTypes are the column types which can be dumped, without lengths or type parameters.
+var supportedTypes = map[string]bool{
+	"BOOL":      true,
+	"INT64":     true,
+	"FLOAT32":   true,
+	"FLOAT64":   true,
+	"NUMERIC":   true,
+	"STRING":    true,
+	"BYTES":     true,
+	"DATE":      true,
+	"TIMESTAMP": true,
+	"JSON":      true,
+	"INTERVAL":  true,
+	"UUID":      true,
+	"PROTO":     true,
+	"ENUM":      true,
+}
+
+// isSupportedType returns true if values of the column type can be dumped, e.g. "ARRAY<STRING(MAX)>"
+// and "ARRAY<FLOAT32>(vector_length=>128)".
+func isSupportedType(typ string) bool {
+	typ = strings.ToUpper(strings.TrimSpace(typ))
+	// Strip a trailing length clause, e.g. "(MAX)" or "(vector_length=>128)" of "ARRAY<FLOAT32>(vector_length=>128)".
+	if strings.HasSuffix(typ, ")") {
+		if i := strings.LastIndex(typ, "("); i >= 0 {
+			typ = strings.TrimSpace(typ[:i])
+		}
+	}
+	if strings.HasPrefix(typ, "ARRAY<") && strings.HasSuffix(typ, ">") {
+		typ = strings.TrimSpace(typ[len("ARRAY<") : len(typ)-1])
+	}
+	if i := strings.IndexAny(typ, "(<"); i >= 0 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+	return supportedTypes[typ]
+}
+
+func (t *Table) String() string {
+	return fmt.Sprintf("{Name: %q, Columns: %v, PrimaryKeys: %v, ChildTables: %v}", t.Name, t.Columns, t.PrimaryKeys, t.ChildTables)
+}
+
+func (t *Table) quotedColumnList() string {
+	var quoted []string
+	for _, c := range t.Columns {
+		quoted = append(quoted, fmt.Sprintf("`%s`", c.Name))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// selectList returns the list of expressions to query the columns, where NULL is read for nulled columns.
+func (t *Table) selectList() string {
+	var exprs []string
+	for _, c := range t.Columns {
+		if c.null {
+			exprs = append(exprs, fmt.Sprintf("NULL AS `%s`", c.Name))
+			continue
+		}
+		exprs = append(exprs, fmt.Sprintf("`%s`", c.Name))
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (t *Table) quotedPrimaryKeyList() string {
+	var quoted []string
+	for _, c := range t.PrimaryKeys {
+		quoted = append(quoted, fmt.Sprintf("`%s`", c))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// TableIterator is an iterator to get tables in the database one by one.
+type TableIterator struct {
+	tables []*Table
+}
+
+// Do executes a given func with each table in the database.
+func (i *TableIterator) Do(f func(*Table) error) error {
+	for _, t := range i.tables {
+		if err := f(t); err != nil {
+			return err
+		}
+		if len(t.ChildTables) > 0 {
+			childIter := &TableIterator{t.ChildTables}
+			if err := childIter.Do(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type tableRow struct {
+	name        string
+	parentName  string
+	columns     []Column
+	primaryKeys []string
+}
+
+// SQL for fetching table name, parent, columns, and primary keys
+// NOTE: columns, types, defaults and commit timestamps are aggregated in the same group, so they are in the same order.
+const fetchTablesSQL = `
+SELECT t.TABLE_NAME as table, t.PARENT_TABLE_NAME as parent, c.columns, c.types, c.defaults, c.commit_timestamps,
+  ARRAY(
+    SELECT ic.COLUMN_NAME
+    FROM INFORMATION_SCHEMA.INDEX_COLUMNS AS ic
+    WHERE ic.TABLE_CATALOG = '' AND ic.TABLE_SCHEMA = '' AND ic.TABLE_NAME = t.TABLE_NAME AND ic.INDEX_TYPE = 'PRIMARY_KEY'
+    ORDER BY ic.ORDINAL_POSITION
+  ) as primary_keys
+FROM INFORMATION_SCHEMA.TABLES as t
+JOIN (
+    SELECT c.TABLE_NAME as table, ARRAY_AGG(c.COLUMN_NAME) as columns, ARRAY_AGG(c.SPANNER_TYPE) as types,
+      ARRAY_AGG(IFNULL(c.COLUMN_DEFAULT, '')) as defaults, ARRAY_AGG(IFNULL(co.OPTION_VALUE = 'TRUE', FALSE)) as commit_timestamps
+    FROM INFORMATION_SCHEMA.COLUMNS AS c
+    LEFT JOIN INFORMATION_SCHEMA.COLUMN_OPTIONS AS co
+    ON co.TABLE_CATALOG = c.TABLE_CATALOG AND co.TABLE_SCHEMA = c.TABLE_SCHEMA AND co.TABLE_NAME = c.TABLE_NAME
+      AND co.COLUMN_NAME = c.COLUMN_NAME AND co.OPTION_NAME = 'allow_commit_timestamp'
+    WHERE c.TABLE_CATALOG = '' AND c.TABLE_SCHEMA = '' AND c.IS_GENERATED = 'NEVER'
+    GROUP BY c.TABLE_NAME
+) as c
+ON t.TABLE_NAME = c.table
+WHERE t.TABLE_CATALOG = '' AND t.TABLE_SCHEMA = '' AND t.TABLE_TYPE = 'BASE TABLE'
+ORDER BY t.TABLE_NAME ASC
+`
+
+// FetchTables fetches all table information in the database from Spanner.
+// The query is tagged with DefaultRequestTag.
+func FetchTables(ctx context.Context, txn *spanner.ReadOnlyTransaction) (*TableIterator, error) {
+	return fetchTables(ctx, txn, spanner.QueryOptions{
+		Priority:   sppb.RequestOptions_PRIORITY_LOW,
+		RequestTag: DefaultRequestTag + "/fetch-tables",
+	})
+}
+
+func fetchTables(ctx context.Context, txn *spanner.ReadOnlyTransaction, opts spanner.QueryOptions) (*TableIterator, error) {
+	ctx, span := startSpan(ctx, "spanner_dump.FetchTables")
+	iter, err := queryTables(ctx, txn, opts)
+	endSpan(span, err)
+	return iter, err
+}
+
+func queryTables(ctx context.Context, txn *spanner.ReadOnlyTransaction, opts spanner.QueryOptions) (*TableIterator, error) {
+	stmt := spanner.NewStatement(fetchTablesSQL)
+	var rows []tableRow
+	if err := txn.QueryWithOptions(ctx, stmt, opts).Do(func(r *spanner.Row) error {
+		var tableName, parentTableName string
+		var columnNames, columnTypes, columnDefaults, primaryKeys []string
+		var commitTimestamps []bool
+		var parentTableNamePtr *string // nullable
+
+		if err := r.ColumnByName("table", &tableName); err != nil {
+			return err
+		}
+
+		if err := r.ColumnByName("parent", &parentTableNamePtr); err != nil {
+			return err
+		}
+		if parentTableNamePtr != nil {
+			parentTableName = *parentTableNamePtr
+		}
+
+		if err := r.ColumnByName("columns", &columnNames); err != nil {
+			return err
+		}
+		if err := r.ColumnByName("types", &columnTypes); err != nil {
+			return err
+		}
+		if err := r.ColumnByName("defaults", &columnDefaults); err != nil {
+			return err
+		}
+		if err := r.ColumnByName("commit_timestamps", &commitTimestamps); err != nil {
+			return err
+		}
+		if len(columnNames) != len(columnTypes) || len(columnNames) != len(columnDefaults) || len(columnNames) != len(commitTimestamps) {
+			return fmt.Errorf("unexpected number of column attributes for table %s: %d columns, %d types, %d defaults, %d commit timestamps",
+				tableName, len(columnNames), len(columnTypes), len(columnDefaults), len(commitTimestamps))
+		}
+		columns := make([]Column, len(columnNames))
+		for i := range columnNames {
+			columns[i] = Column{
+				Name:                 columnNames[i],
+				Type:                 columnTypes[i],
+				Default:              columnDefaults[i],
+				AllowCommitTimestamp: commitTimestamps[i],
+			}
+		}
+
+		if err := r.ColumnByName("primary_keys", &primaryKeys); err != nil {
+			return err
+		}
+
+		rows = append(rows, tableRow{
+			name:        tableName,
+			columns:     columns,
+			parentName:  parentTableName,
+			primaryKeys: primaryKeys,
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Tables whose parent is not visible, e.g. to a database role which can't access the parent, are regarded as root.
+	names := map[string]bool{}
+	for _, row := range rows {
+		names[row.name] = true
+	}
+	for i := range rows {
+		if !names[rows[i].parentName] {
+			rows[i].parentName = ""
+		}
+	}
+	tables := findChildTables(rows, "") // root
+	return &TableIterator{tables}, nil
+}
+
+func findChildTables(rows []tableRow, parent string) []*Table {
+	var tables []*Table
+	for _, row := range rows {
+		if row.parentName == parent {
+			tables = append(tables, &Table{
+				Name:        row.name,
+				Columns:     row.columns,
+				PrimaryKeys: row.primaryKeys,
+				ChildTables: findChildTables(rows, row.name),
+			})
+		}
+	}
+	return tables
+}
@@ -14,7 +14,7 @@
 // limitations under the License.
 //
 
-package main
+package dump
 
 import (
 	"testing"
@@ -28,17 +28,17 @@ func TestQuotedColumnList(t *testing.T) {
 	}{
 		{
 			desc:  "No columns",
-			table: &Table{Columns: []string{}},
+			table: &Table{Columns: []Column{}},
 			want:  "",
 		},
 		{
 			desc:  "Single column",
-			table: &Table{Columns: []string{"C1"}},
+			table: &Table{Columns: []Column{{Name: "C1"}}},
 			want:  "`C1`",
 		},
 		{
 			desc:  "Multiple columns",
-			table: &Table{Columns: []string{"C1", "C2"}},
+			table: &Table{Columns: []Column{{Name: "C1"}, {Name: "C2"}}},
 			want:  "`C1`, `C2`",
 		},
 	} {
@@ -51,6 +51,39 @@ func TestQuotedColumnList(t *testing.T) {
 
 }
 
+func TestSelectList(t *testing.T) {
+	table := &Table{Columns: []Column{{Name: "C1"}, {Name: "C2", null: true}}}
+	if got, want := table.selectList(), "`C1`, NULL AS `C2`"; got != want {
+		t.Errorf("selectList() of %v: got = %v, want = %v", table, got, want)
+	}
+}
+
+func TestIsSupportedType(t *testing.T) {
+	for _, tt := range []struct {
+		typ  string
+		want bool
+	}{
+		{typ: "INT64", want: true},
+		{typ: "STRING(MAX)", want: true},
+		{typ: "BYTES(1024)", want: true},
+		{typ: "ARRAY<FLOAT32>", want: true},
+		{typ: "ARRAY<STRING(10)>", want: true},
+		{typ: "ARRAY<FLOAT32>(vector_length=>128)", want: true},
+		{typ: "ARRAY<FLOAT64>(vector_length=>3)", want: true},
+		{typ: "PROTO<example.Album>", want: true},
+		{typ: "ARRAY<ENUM<example.Genre>>", want: true},
+		{typ: "TOKENLIST", want: false},
+		{typ: "ARRAY<STRUCT<a INT64>>", want: false},
+		{typ: "GEOGRAPHY", want: false},
+	} {
+		t.Run(tt.typ, func(t *testing.T) {
+			if got := isSupportedType(tt.typ); got != tt.want {
+				t.Errorf("isSupportedType(%q) = %v, want = %v", tt.typ, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFindChildTables(t *testing.T) {
 	// Table Tree:
 	// (Root)
@@ -59,17 +92,17 @@ func TestFindChildTables(t *testing.T) {
 	//    |   |- T3
 	//    |       |- T4
 	//    |- T5
-	tr1 := tableRow{name: "T1", parentName: "", columns: []string{"T1_C1", "T1_C2"}}
-	tr2 := tableRow{name: "T2", parentName: "T1", columns: []string{"T2_C1", "T2_C2"}}
-	tr3 := tableRow{name: "T3", parentName: "T1", columns: []string{"T3_C1", "T3_C2"}}
-	tr4 := tableRow{name: "T4", parentName: "T3", columns: []string{"T4_C1", "T4_C2"}}
-	tr5 := tableRow{name: "T5", parentName: "", columns: []string{"T5_C1", "T5_C2"}}
-
-	t4 := &Table{Name: "T4", Columns: []string{"T4_C1", "T4_C2"}, ChildTables: nil}
-	t2 := &Table{Name: "T2", Columns: []string{"T2_C1", "T2_C2"}, ChildTables: nil}
-	t5 := &Table{Name: "T5", Columns: []string{"T5_C1", "T5_C2"}, ChildTables: nil}
-	t3 := &Table{Name: "T3", Columns: []string{"T3_C1", "T3_C2"}, ChildTables: []*Table{t4}}
-	t1 := &Table{Name: "T1", Columns: []string{"T1_C1", "T1_C2"}, ChildTables: []*Table{t2, t3}}
+	tr1 := tableRow{name: "T1", parentName: "", columns: []Column{{Name: "T1_C1"}, {Name: "T1_C2"}}, primaryKeys: []string{"T1_C1"}}
+	tr2 := tableRow{name: "T2", parentName: "T1", columns: []Column{{Name: "T2_C1"}, {Name: "T2_C2"}}}
+	tr3 := tableRow{name: "T3", parentName: "T1", columns: []Column{{Name: "T3_C1"}, {Name: "T3_C2"}}}
+	tr4 := tableRow{name: "T4", parentName: "T3", columns: []Column{{Name: "T4_C1"}, {Name: "T4_C2"}}}
+	tr5 := tableRow{name: "T5", parentName: "", columns: []Column{{Name: "T5_C1"}, {Name: "T5_C2"}}}
+
+	t4 := &Table{Name: "T4", Columns: []Column{{Name: "T4_C1"}, {Name: "T4_C2"}}, ChildTables: nil}
+	t2 := &Table{Name: "T2", Columns: []Column{{Name: "T2_C1"}, {Name: "T2_C2"}}, ChildTables: nil}
+	t5 := &Table{Name: "T5", Columns: []Column{{Name: "T5_C1"}, {Name: "T5_C2"}}, ChildTables: nil}
+	t3 := &Table{Name: "T3", Columns: []Column{{Name: "T3_C1"}, {Name: "T3_C2"}}, ChildTables: []*Table{t4}}
+	t1 := &Table{Name: "T1", Columns: []Column{{Name: "T1_C1"}, {Name: "T1_C2"}}, PrimaryKeys: []string{"T1_C1"}, ChildTables: []*Table{t2, t3}}
 
 	for _, tt := range []struct {
 		desc   string
@@ -145,5 +178,14 @@ func equalsTable(t1, t2 *Table) bool {
 		}
 	}
 
+	if len(t1.PrimaryKeys) != len(t2.PrimaryKeys) {
+		return false
+	}
+	for i := 0; i < len(t1.PrimaryKeys); i++ {
+		if t1.PrimaryKeys[i] != t2.PrimaryKeys[i] {
+			return false
+		}
+	}
+
 	return equalsTables(t1.ChildTables, t2.ChildTables)
 }
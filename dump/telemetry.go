@@ -0,0 +1,100 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer and the meter of this package.
+// Spans and metrics are recorded by the global providers of OpenTelemetry, which are no-op unless they are set.
+const instrumentationName = "github.com/cloudspannerecosystem/spanner-dump/dump"
+
+// Names of metrics recorded for each table, with the attribute attrTable.
+const (
+	metricTableRows     = "spanner_dump.table.rows"
+	metricTableBytes    = "spanner_dump.table.bytes"
+	metricTableDuration = "spanner_dump.table.duration"
+)
+
+// Attribute keys of spans and metrics.
+const (
+	attrDatabase = attribute.Key("spanner_dump.database")
+	attrTable    = attribute.Key("spanner_dump.table")
+	attrRows     = attribute.Key("spanner_dump.rows")
+)
+
+// startSpan starts a span of the global tracer provider. The returned context propagates the span to the Spanner client.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, recording the error if it's not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tableMetrics records metrics of dumped tables.
+type tableMetrics struct {
+	rows     metric.Int64Counter
+	bytes    metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// newTableMetrics creates instruments of the global meter provider.
+// Errors are reported to the global error handler of OpenTelemetry, and the failed instruments are no-op.
+func newTableMetrics() *tableMetrics {
+	meter := otel.Meter(instrumentationName)
+	rows, err := meter.Int64Counter(metricTableRows, metric.WithUnit("{row}"), metric.WithDescription("Number of rows dumped from the table."))
+	if err != nil {
+		otel.Handle(err)
+		rows = noop.Int64Counter{}
+	}
+	bytes, err := meter.Int64Counter(metricTableBytes, metric.WithUnit("By"), metric.WithDescription("Size of the table records written by the encoder."))
+	if err != nil {
+		otel.Handle(err)
+		bytes = noop.Int64Counter{}
+	}
+	duration, err := meter.Float64Histogram(metricTableDuration, metric.WithUnit("s"), metric.WithDescription("Time taken to dump the table."))
+	if err != nil {
+		otel.Handle(err)
+		duration = noop.Float64Histogram{}
+	}
+	return &tableMetrics{rows: rows, bytes: bytes, duration: duration}
+}
+
+// record records metrics of dumping the table. bytes is nil if it's unknown.
+func (m *tableMetrics) record(ctx context.Context, database, table string, rows int64, bytes *int64, elapsed time.Duration) {
+	attrs := metric.WithAttributes(attrDatabase.String(database), attrTable.String(table))
+	m.rows.Add(ctx, rows, attrs)
+	if bytes != nil {
+		m.bytes.Add(ctx, *bytes, attrs)
+	}
+	m.duration.Record(ctx, elapsed.Seconds(), attrs)
+}
@@ -0,0 +1,99 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetryWithFakeServer(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	tracerProvider, meterProvider := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	defer func() {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetMeterProvider(meterProvider)
+	}()
+
+	server := newFakeServer(t)
+	out := &bytes.Buffer{}
+	dumper := newFakeDumper(t, server, Options{Out: out, Tables: []string{"t1", "t2"}})
+	dumpAll(t, dumper)
+
+	// Spans of this package, with the names of their parents.
+	names := map[string]string{}
+	for _, s := range spans.Ended() {
+		names[s.SpanContext().SpanID().String()] = s.Name()
+	}
+	var got []string
+	for _, s := range spans.Ended() {
+		if s.InstrumentationScope().Name == instrumentationName {
+			got = append(got, names[s.Parent().SpanID().String()]+" > "+s.Name())
+		}
+	}
+	want := []string{
+		" > spanner_dump.DumpDDLs",
+		"spanner_dump.DumpTables > spanner_dump.FetchTables",
+		"spanner_dump.DumpTables > spanner_dump.dumpTable",
+		"spanner_dump.DumpTables > spanner_dump.dumpTable",
+		" > spanner_dump.DumpTables",
+	}
+	if !equalStringSlice(got, want) {
+		t.Errorf("spans = %q, want = %q", got, want)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	rows := map[string]int64{}
+	var bytesSum int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				table, _ := dp.Attributes.Value(attrTable)
+				switch m.Name {
+				case metricTableRows:
+					rows[table.AsString()] = dp.Value
+				case metricTableBytes:
+					bytesSum += dp.Value
+				}
+			}
+		}
+	}
+	if rows["t1"] != 3 || rows["t2"] != 2 || len(rows) != 2 {
+		t.Errorf("rows metric = %v, want 3 rows of t1 and 2 rows of t2", rows)
+	}
+	// The output has DDLs, which are not counted.
+	if bytesSum == 0 || bytesSum >= int64(out.Len()) {
+		t.Errorf("bytes metric = %d, want the size of records less than the output size %d", bytesSum, out.Len())
+	}
+}
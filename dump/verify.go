@@ -0,0 +1,237 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// maxSampleKeys is the max number of differing primary keys reported for each kind of difference.
+const maxSampleKeys = 10
+
+// TableMismatch describes a table whose data in the database differs from the dump.
+type TableMismatch struct {
+	Dumped TableChecksum
+	Actual TableChecksum
+
+	// MissingTable is true if the table is in the dump, but not in the database. Actual is empty in that case.
+	MissingTable bool
+
+	// Sample primary keys of differing rows. They are available only if row checksums are given to Verify.
+	MissingKeys []string // rows in the dump, but not in the database
+	ExtraKeys   []string // rows in the database, but not in the dump
+	ChangedKeys []string // rows whose values differ
+}
+
+// Verify compares tables in the database with the checksums recorded in the manifest, and returns mismatched tables.
+//
+// The database is read at Options.Timestamp, Options.Staleness or Options.MaxStaleness as Dumper does if any is specified.
+// Otherwise, the database is read at the read timestamp of the manifest if the manifest is of the same database,
+// e.g. to check the consistency of a dump, or the latest data is read if the manifest is of another database,
+// e.g. to check a restored database.
+//
+// Tables are read by plain queries without query statistics, and aren't recorded as dumped in metrics or Stats.
+//
+// Tables are read as they are dumped with Manifest.UnsupportedTypes, or Options.UnsupportedTypes if it's not recorded.
+// If Manifest.DatabaseRole is recorded, the database must be read with the same Options.DatabaseRole.
+//
+// If rowChecksums, which is written by ChecksumEncoder, is given, sample primary keys of differing rows are reported.
+func (d *Dumper) Verify(ctx context.Context, manifest *Manifest, rowChecksums io.Reader) ([]TableMismatch, error) {
+	if manifest.DatabaseRole != "" && manifest.DatabaseRole != d.databaseRole {
+		return nil, fmt.Errorf("the dump was made with database role %q, but the database is read with %q", manifest.DatabaseRole, d.databaseRole)
+	}
+	unsupportedTypes := manifest.UnsupportedTypes
+	if unsupportedTypes == "" {
+		unsupportedTypes = d.unsupportedTypes
+	}
+	if err := validateUnsupportedTypes(unsupportedTypes); err != nil {
+		return nil, err
+	}
+
+	txn := d.client.ReadOnlyTransaction()
+	switch {
+	case d.timestamp != nil || d.staleness > 0 || d.maxStaleness > 0:
+		bound, err := d.timestampBound(ctx)
+		if err != nil {
+			return nil, err
+		}
+		txn = txn.WithTimestampBound(bound)
+	case manifest.Database == d.dbPath:
+		txn = txn.WithTimestampBound(spanner.ReadTimestamp(manifest.ReadTimestamp))
+	}
+	defer txn.Close()
+
+	iter, err := d.fetchTables(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	inManifest := map[string]bool{}
+	for _, t := range manifest.Tables {
+		inManifest[t.Name] = true
+	}
+	var fetched []*Table
+	if err := iter.Do(func(t *Table) error {
+		if inManifest[t.Name] {
+			fetched = append(fetched, t)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	prepared, err := d.prepareTables(ctx, txn, fetched, unsupportedTypes)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]*Table{}
+	for _, t := range prepared {
+		tables[t.Name] = t
+	}
+
+	var mismatches []TableMismatch
+	for _, dumped := range manifest.Tables {
+		t, ok := tables[dumped.Name]
+		if !ok {
+			mismatches = append(mismatches, TableMismatch{Dumped: dumped, Actual: TableChecksum{Name: dumped.Name}, MissingTable: true})
+			continue
+		}
+		encoder := NewChecksumEncoder(nil)
+		if err := d.verifyTable(ctx, t, txn, encoder); err != nil {
+			return nil, err
+		}
+		if actual := encoder.Checksums()[0]; actual != dumped {
+			mismatches = append(mismatches, TableMismatch{Dumped: dumped, Actual: actual})
+		}
+	}
+	if len(mismatches) == 0 || rowChecksums == nil {
+		return mismatches, nil
+	}
+
+	recorded, err := readRowChecksums(rowChecksums, mismatches)
+	if err != nil {
+		return nil, err
+	}
+	for i := range mismatches {
+		m := &mismatches[i]
+		rows := recorded[m.Dumped.Name]
+		comparer := &rowChecksumComparer{recorded: rows}
+		if !m.MissingTable {
+			if err := d.verifyTable(ctx, tables[m.Dumped.Name], txn, comparer); err != nil {
+				return nil, err
+			}
+		}
+		m.ExtraKeys = comparer.extraKeys
+		m.ChangedKeys = comparer.changedKeys
+		// Rows remained in the recorded checksums don't exist in the database.
+		for key := range rows {
+			m.MissingKeys = append(m.MissingKeys, key)
+		}
+		sort.Strings(m.MissingKeys)
+		if len(m.MissingKeys) > maxSampleKeys {
+			m.MissingKeys = m.MissingKeys[:maxSampleKeys]
+		}
+	}
+	return mismatches, nil
+}
+
+// verifyTable reads all rows of the table into the encoder. Unlike dumpTable, it doesn't record metrics or stats,
+// and the rows are read in any order, as checksums don't depend on the order.
+func (d *Dumper) verifyTable(ctx context.Context, table *Table, txn *spanner.ReadOnlyTransaction, encoder RowEncoder) error {
+	iter := queryTable(ctx, table, txn, false, d.queryOptions(table.Name+"/verify"))
+	defer iter.Stop()
+	if err := encoder.BeginTable(table); err != nil {
+		return err
+	}
+	if _, err := writeRows([]*spanner.RowIterator{iter}, encoder, nil); err != nil {
+		return fmt.Errorf("failed to read table %s: %w", table.Name, err)
+	}
+	return encoder.EndTable()
+}
+
+// readRowChecksums reads row checksums of the mismatched tables, and returns them as table name -> primary key -> checksum.
+func readRowChecksums(r io.Reader, mismatches []TableMismatch) (map[string]map[string]string, error) {
+	recorded := map[string]map[string]string{}
+	for _, m := range mismatches {
+		recorded[m.Dumped.Name] = map[string]string{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024) // primary keys can be long
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid row checksum: %q", scanner.Text())
+		}
+		if rows, ok := recorded[fields[0]]; ok {
+			rows[fields[1]] = fields[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// rowChecksumComparer is a RowEncoder to compare rows with the recorded row checksums.
+// Compared rows are removed from the recorded checksums.
+type rowChecksumComparer struct {
+	recorded    map[string]string
+	keyIndex    []int
+	extraKeys   []string
+	changedKeys []string
+}
+
+func (c *rowChecksumComparer) BeginTable(table *Table) error {
+	c.keyIndex = primaryKeyIndex(table)
+	return nil
+}
+
+func (c *rowChecksumComparer) WriteRow(values []spanner.GenericColumnValue) error {
+	decoded, checksum, err := decodeRowChecksum(values)
+	if err != nil {
+		return err
+	}
+
+	key := primaryKeyString(decoded, c.keyIndex)
+	recorded, ok := c.recorded[key]
+	switch {
+	case !ok:
+		if len(c.extraKeys) < maxSampleKeys {
+			c.extraKeys = append(c.extraKeys, key)
+		}
+	case recorded != fmt.Sprintf("%016x", checksum):
+		if len(c.changedKeys) < maxSampleKeys {
+			c.changedKeys = append(c.changedKeys, key)
+		}
+	}
+	delete(c.recorded, key)
+	return nil
+}
+
+func (c *rowChecksumComparer) EndTable() error {
+	return nil
+}
+
+func (c *rowChecksumComparer) Finish() error {
+	return nil
+}
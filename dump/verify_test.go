@@ -0,0 +1,247 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dump
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudspannerecosystem/spanner-dump/internal/fakespanner"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestVerifyWithFakeServer(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+
+	rowChecksums := &bytes.Buffer{}
+	checksumEncoder := NewChecksumEncoder(rowChecksums)
+	dumper := newFakeDumper(t, server, Options{
+		Encoder: MultiEncoder(NewSQLEncoder(&bytes.Buffer{}, EncoderOptions{}), checksumEncoder),
+	})
+	if err := dumper.DumpTables(ctx); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+	manifest := &Manifest{
+		Database:      dumper.DatabasePath(),
+		ReadTimestamp: dumper.ReadTimestamp(),
+		Tables:        checksumEncoder.Checksums(),
+	}
+	if !manifest.ReadTimestamp.Equal(server.ReadTimestamp()) {
+		t.Errorf("ReadTimestamp() = %v, want = %v", manifest.ReadTimestamp, server.ReadTimestamp())
+	}
+	if len(manifest.Tables) != len(fakeTables) {
+		t.Fatalf("Checksums() = %v, want %d tables", manifest.Tables, len(fakeTables))
+	}
+
+	mismatches, err := dumper.Verify(ctx, manifest, bytes.NewReader(rowChecksums.Bytes()))
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Verify() = %+v, want no mismatches", mismatches)
+	}
+
+	// Change, delete and insert rows of t1.
+	t1 := fakeTables[0]
+	server.PutStatementResult("SELECT `Id`, `Name`, `Tags` FROM `t1`", fakespanner.NewResultSet(t1.columns,
+		[]*structpb.Value{fakespanner.IntValue(1), fakespanner.StringValue("changed"), fakespanner.StringListValue("a", "b")},
+		t1.rows[2],
+		[]*structpb.Value{fakespanner.IntValue(4), fakespanner.NullValue(), fakespanner.NullValue()},
+	))
+	// t2 has no rows.
+	server.PutStatementResult("SELECT `T2Id` FROM `t2`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("T2Id", fakespanner.Type(sppb.TypeCode_INT64)),
+	}))
+
+	mismatches, err = dumper.Verify(ctx, manifest, bytes.NewReader(rowChecksums.Bytes()))
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 2 {
+		t.Fatalf("Verify() = %+v, want 2 mismatches", mismatches)
+	}
+
+	m := mismatches[0]
+	if m.Dumped.Name != "t1" || m.Dumped.Rows != 3 || m.Actual.Rows != 3 {
+		t.Errorf("mismatch = %+v, want t1 with 3 rows in both", m)
+	}
+	if !equalStringSlice(m.MissingKeys, []string{"(2)"}) {
+		t.Errorf("MissingKeys = %q, want = %q", m.MissingKeys, []string{"(2)"})
+	}
+	if !equalStringSlice(m.ExtraKeys, []string{"(4)"}) {
+		t.Errorf("ExtraKeys = %q, want = %q", m.ExtraKeys, []string{"(4)"})
+	}
+	if !equalStringSlice(m.ChangedKeys, []string{"(1)"}) {
+		t.Errorf("ChangedKeys = %q, want = %q", m.ChangedKeys, []string{"(1)"})
+	}
+
+	m = mismatches[1]
+	if m.Dumped.Name != "t2" || m.Actual.Rows != 0 || !equalStringSlice(m.MissingKeys, []string{"(1)", "(2)"}) {
+		t.Errorf("mismatch = %+v, want t2 with missing keys (1) and (2)", m)
+	}
+}
+
+func TestVerifyMissingTableWithFakeServer(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+
+	rowChecksums := &bytes.Buffer{}
+	checksumEncoder := NewChecksumEncoder(rowChecksums)
+	dumper := newFakeDumper(t, server, Options{Encoder: checksumEncoder})
+	if err := dumper.DumpTables(ctx); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+	manifest := &Manifest{
+		Database:      dumper.DatabasePath(),
+		ReadTimestamp: dumper.ReadTimestamp(),
+		Tables:        checksumEncoder.Checksums(),
+	}
+
+	// t3 is dropped after the dump.
+	putFakeTables(server, "", fakeTables[:2])
+
+	mismatches, err := dumper.Verify(ctx, manifest, bytes.NewReader(rowChecksums.Bytes()))
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("Verify() = %+v, want 1 mismatch", mismatches)
+	}
+	m := mismatches[0]
+	if m.Dumped.Name != "t3" || !m.MissingTable || m.Actual != (TableChecksum{Name: "t3"}) {
+		t.Errorf("mismatch = %+v, want missing table t3", m)
+	}
+	if !equalStringSlice(m.MissingKeys, []string{"(1, 1)"}) {
+		t.Errorf("MissingKeys = %q, want = %q", m.MissingKeys, []string{"(1, 1)"})
+	}
+
+	// A missing table is reported even if it was empty.
+	manifest.Tables[2].Rows = 0
+	manifest.Tables[2].Checksum = "0000000000000000"
+	mismatches, err = dumper.Verify(ctx, manifest, nil)
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 1 || !mismatches[0].MissingTable {
+		t.Errorf("Verify() = %+v, want missing table t3", mismatches)
+	}
+}
+
+func TestVerifyUnsupportedTypesWithFakeServer(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+	database := "projects/fake-project/instances/fake-instance/databases/unsupported"
+	putFakeTables(server, database, []fakeTable{
+		{
+			name: "t7",
+			columns: []*sppb.StructType_Field{
+				fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+				fakespanner.Field("Shape", fakespanner.Type(sppb.TypeCode_STRING)),
+			},
+			types:       []string{"INT64", "GEOGRAPHY"},
+			primaryKeys: []string{"Id"},
+			rows: [][]*structpb.Value{
+				{fakespanner.IntValue(1), fakespanner.StringValue("POINT(1 2)")},
+			},
+		},
+	})
+	server.PutDatabaseStatementResult(database, "SELECT `Id` FROM `t7`", fakespanner.NewResultSet([]*sppb.StructType_Field{
+		fakespanner.Field("Id", fakespanner.Type(sppb.TypeCode_INT64)),
+	}, []*structpb.Value{fakespanner.IntValue(1)}))
+
+	newDumper := func(opts Options) *Dumper {
+		client, adminClient := newFakeClients(t, server, database)
+		dumper, err := NewDumperWithClients(ctx, opts, client, adminClient)
+		if err != nil {
+			t.Fatalf("failed to create dumper: %v", err)
+		}
+		return dumper
+	}
+
+	checksumEncoder := NewChecksumEncoder(nil)
+	dumper := newDumper(Options{Encoder: checksumEncoder, UnsupportedTypes: UnsupportedTypesSkip})
+	if err := dumper.DumpTables(ctx); err != nil {
+		t.Fatalf("failed to dump tables: %v", err)
+	}
+	manifest := &Manifest{
+		Database:         dumper.DatabasePath(),
+		ReadTimestamp:    dumper.ReadTimestamp(),
+		Tables:           checksumEncoder.Checksums(),
+		UnsupportedTypes: UnsupportedTypesSkip,
+	}
+
+	// The recorded way to handle unsupported types is used instead of the default error.
+	mismatches, err := newDumper(Options{}).Verify(ctx, manifest, nil)
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Verify() = %+v, want no mismatches", mismatches)
+	}
+
+	manifest.DatabaseRole = "reader"
+	if _, err := newDumper(Options{}).Verify(ctx, manifest, nil); err == nil || !strings.Contains(err.Error(), `database role "reader"`) {
+		t.Errorf("Verify() = %v, want error for database role", err)
+	}
+}
+
+func TestVerifyWithFakeServer_ReadOptions(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+	server.SetVersionRetention(fakeDatabasePath, "1h", time.Now().Add(-time.Hour))
+
+	checksumEncoder := NewChecksumEncoder(nil)
+	dumpAll(t, newFakeDumper(t, server, Options{Out: &bytes.Buffer{}, Encoder: checksumEncoder}))
+	manifest := &Manifest{
+		Database:      fakeDatabasePath,
+		ReadTimestamp: server.ReadTimestamp(),
+		Tables:        checksumEncoder.Checksums(),
+	}
+
+	// Verification is read at the staleness instead of the read timestamp of the manifest, without statistics or retries.
+	dumper := newFakeDumper(t, server, Options{Staleness: 15 * time.Second, CollectStats: true, MaxRetries: 2})
+	executed := len(server.ExecutedRequests())
+	mismatches, err := dumper.Verify(ctx, manifest, nil)
+	if err != nil {
+		t.Fatalf("Verify() failed unexpectedly: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Verify() = %+v, want no mismatches", mismatches)
+	}
+
+	txns := server.TransactionOptions()
+	want := &sppb.TransactionOptions_ReadOnly{ReturnReadTimestamp: true, TimestampBound: &sppb.TransactionOptions_ReadOnly_ExactStaleness{ExactStaleness: durationpb.New(15 * time.Second)}}
+	if got := txns[len(txns)-1].GetReadOnly(); !proto.Equal(got, want) {
+		t.Errorf("read-only transaction = %v, want = %v", got, want)
+	}
+	for _, req := range server.ExecutedRequests()[executed:] {
+		if req.QueryMode == sppb.ExecuteSqlRequest_PROFILE || strings.Contains(req.Sql, "ORDER BY `") {
+			t.Errorf("request %q is in mode %v, want a plain query", req.Sql, req.QueryMode)
+		}
+	}
+	if stats := dumper.Stats(); len(stats.Tables) != 0 {
+		t.Errorf("Stats().Tables = %+v, want no tables", stats.Tables)
+	}
+}
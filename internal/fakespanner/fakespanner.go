@@ -0,0 +1,521 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package fakespanner provides an in-process fake Cloud Spanner server for testing.
+//
+// The fake server doesn't interpret SQL. Instead, results of queries are registered
+// for each SQL text in advance, like the mock server of the Cloud Spanner client library.
+// DML statements and DDL statements are recorded, so that tests can check what was applied.
+package fakespanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	lropb "cloud.google.com/go/longrunning/autogen/longrunningpb"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// Server is a fake Cloud Spanner server, which serves both Spanner API and Database Admin API.
+type Server struct {
+	grpcServer *grpc.Server
+	lis        net.Listener
+
+	mu            sync.Mutex
+	results       map[string]*sppb.ResultSet
+	dbResults     map[string]map[string]*sppb.ResultSet
+	errors        map[string]error
+	dbErrors      map[string]error
+	streamErrors  map[string]*streamError
+	ddls          map[string][]string
+	descriptors   map[string][]byte
+	retention     map[string]*adminpb.Database
+	executed      []string
+	requests      []*sppb.ExecuteSqlRequest
+	transactions  []*sppb.TransactionOptions
+	counter       int
+	readTimestamp time.Time
+}
+
+// NewServer starts a fake server listening on a local port.
+func NewServer() (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		grpcServer:    grpc.NewServer(),
+		lis:           lis,
+		results:       map[string]*sppb.ResultSet{},
+		dbResults:     map[string]map[string]*sppb.ResultSet{},
+		errors:        map[string]error{},
+		dbErrors:      map[string]error{},
+		streamErrors:  map[string]*streamError{},
+		ddls:          map[string][]string{},
+		descriptors:   map[string][]byte{},
+		retention:     map[string]*adminpb.Database{},
+		readTimestamp: time.Date(2020, 1, 23, 3, 0, 0, 0, time.UTC),
+	}
+	sppb.RegisterSpannerServer(s.grpcServer, &spannerServer{s: s})
+	adminpb.RegisterDatabaseAdminServer(s.grpcServer, &adminServer{s: s})
+	go s.grpcServer.Serve(lis)
+	return s, nil
+}
+
+// Addr returns the address of the server.
+func (s *Server) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// ClientOptions returns options to connect to the server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.Addr()),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+		option.WithoutAuthentication(),
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.grpcServer.Stop()
+}
+
+// PutStatementResult registers the result of the given SQL.
+// SQL is compared ignoring differences in whitespace.
+func (s *Server) PutStatementResult(sql string, result *sppb.ResultSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[normalizeSQL(sql)] = result
+}
+
+// PutDatabaseStatementResult registers the result of the given SQL only for the database,
+// which takes precedence over the result registered by PutStatementResult.
+func (s *Server) PutDatabaseStatementResult(database, sql string, result *sppb.ResultSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dbResults[database] == nil {
+		s.dbResults[database] = map[string]*sppb.ResultSet{}
+	}
+	s.dbResults[database][normalizeSQL(sql)] = result
+}
+
+// PutStatementError registers an error to be returned for the given SQL.
+func (s *Server) PutStatementError(sql string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[normalizeSQL(sql)] = err
+}
+
+// SetDatabaseError makes all queries and DDL requests of the database fail with err,
+// e.g. PermissionDenied for a database which the caller can't access.
+func (s *Server) SetDatabaseError(database string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbErrors[database] = err
+}
+
+// streamError is an error which breaks a stream of results after some rows.
+type streamError struct {
+	rows int
+	err  error
+}
+
+// PutStatementStreamError makes the next streaming execution of the given SQL fail with err after sending the first rows
+// of its result, like an aborted stream. Later executions return the whole result.
+func (s *Server) PutStatementStreamError(sql string, rows int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streamErrors[normalizeSQL(sql)] = &streamError{rows: rows, err: err}
+}
+
+// SetDDLs sets DDL statements of the database, which is like "projects/p/instances/i/databases/d".
+func (s *Server) SetDDLs(database string, ddls []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ddls[database] = append([]string(nil), ddls...)
+}
+
+// SetProtoDescriptors sets the proto descriptors of the database, which are returned with DDL statements.
+func (s *Server) SetProtoDescriptors(database string, descriptors []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.descriptors[database] = descriptors
+}
+
+// SetVersionRetention sets the version retention period and the earliest version time of the database,
+// which are returned by GetDatabase.
+func (s *Server) SetVersionRetention(database, period string, earliest time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention[database] = &adminpb.Database{
+		VersionRetentionPeriod: period,
+		EarliestVersionTime:    timestamppb.New(earliest),
+	}
+}
+
+// DDLs returns DDL statements of the database.
+func (s *Server) DDLs(database string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ddls[database]...)
+}
+
+// ExecutedStatements returns all SQL statements executed by clients in order.
+func (s *Server) ExecutedStatements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.executed...)
+}
+
+// ExecutedRequests returns all requests to execute SQL statements in order, e.g. to check their request options.
+func (s *Server) ExecutedRequests() []*sppb.ExecuteSqlRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reqs := make([]*sppb.ExecuteSqlRequest, len(s.requests))
+	for i, req := range s.requests {
+		reqs[i] = proto.Clone(req).(*sppb.ExecuteSqlRequest)
+	}
+	return reqs
+}
+
+// TransactionOptions returns options of all transactions begun by clients in order,
+// including single-use transactions and transactions begun by the first queries.
+func (s *Server) TransactionOptions() []*sppb.TransactionOptions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	opts := make([]*sppb.TransactionOptions, len(s.transactions))
+	for i, o := range s.transactions {
+		opts[i] = proto.Clone(o).(*sppb.TransactionOptions)
+	}
+	return opts
+}
+
+// ReadTimestamp returns the read timestamp of transactions.
+func (s *Server) ReadTimestamp() time.Time {
+	return s.readTimestamp
+}
+
+func (s *Server) nextID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	return s.counter
+}
+
+func (s *Server) execute(req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, sql := req.Session, req.Sql
+	s.executed = append(s.executed, sql)
+	s.requests = append(s.requests, proto.Clone(req).(*sppb.ExecuteSqlRequest))
+	if opts := transactionOptions(req.GetTransaction()); opts != nil {
+		s.transactions = append(s.transactions, proto.Clone(opts).(*sppb.TransactionOptions))
+	}
+	// Session name is like "projects/p/instances/i/databases/d/sessions/s".
+	database := session
+	if i := strings.Index(session, "/sessions/"); i >= 0 {
+		database = session[:i]
+	}
+	if err, ok := s.dbErrors[database]; ok {
+		return nil, err
+	}
+	key := normalizeSQL(sql)
+	if err, ok := s.errors[key]; ok {
+		return nil, err
+	}
+	if result, ok := s.dbResults[database][key]; ok {
+		return result, nil
+	}
+	if result, ok := s.results[key]; ok {
+		return result, nil
+	}
+	return nil, nil
+}
+
+// transactionOptions returns options of the transaction begun by the selector, or nil if it uses an existing transaction.
+func transactionOptions(selector *sppb.TransactionSelector) *sppb.TransactionOptions {
+	if opts := selector.GetSingleUse(); opts != nil {
+		return opts
+	}
+	return selector.GetBegin()
+}
+
+func (s *Server) newTransaction() *sppb.Transaction {
+	return &sppb.Transaction{
+		Id:            []byte(fmt.Sprintf("transaction-%d", s.nextID())),
+		ReadTimestamp: timestamppb.New(s.readTimestamp),
+	}
+}
+
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+type spannerServer struct {
+	sppb.UnimplementedSpannerServer
+	s *Server
+}
+
+func (f *spannerServer) newSession(database string) *sppb.Session {
+	return &sppb.Session{
+		Name:       fmt.Sprintf("%s/sessions/%d", database, f.s.nextID()),
+		CreateTime: timestamppb.Now(),
+	}
+}
+
+func (f *spannerServer) CreateSession(ctx context.Context, req *sppb.CreateSessionRequest) (*sppb.Session, error) {
+	return f.newSession(req.Database), nil
+}
+
+func (f *spannerServer) BatchCreateSessions(ctx context.Context, req *sppb.BatchCreateSessionsRequest) (*sppb.BatchCreateSessionsResponse, error) {
+	resp := &sppb.BatchCreateSessionsResponse{}
+	for i := int32(0); i < req.SessionCount; i++ {
+		resp.Session = append(resp.Session, f.newSession(req.Database))
+	}
+	return resp, nil
+}
+
+func (f *spannerServer) GetSession(ctx context.Context, req *sppb.GetSessionRequest) (*sppb.Session, error) {
+	return &sppb.Session{Name: req.Name}, nil
+}
+
+func (f *spannerServer) DeleteSession(ctx context.Context, req *sppb.DeleteSessionRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (f *spannerServer) BeginTransaction(ctx context.Context, req *sppb.BeginTransactionRequest) (*sppb.Transaction, error) {
+	f.s.mu.Lock()
+	f.s.transactions = append(f.s.transactions, proto.Clone(req.GetOptions()).(*sppb.TransactionOptions))
+	f.s.mu.Unlock()
+	return f.s.newTransaction(), nil
+}
+
+func (f *spannerServer) Commit(ctx context.Context, req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+	return &sppb.CommitResponse{CommitTimestamp: timestamppb.Now()}, nil
+}
+
+func (f *spannerServer) Rollback(ctx context.Context, req *sppb.RollbackRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (f *spannerServer) ExecuteSql(ctx context.Context, req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+	result, err := f.s.execute(req)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		// Unknown statements are regarded as DML statements which modify a single row.
+		result = &sppb.ResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}},
+			Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 1}},
+		}
+	}
+
+	resp := proto.Clone(result).(*sppb.ResultSet)
+	if transactionOptions(req.GetTransaction()) != nil {
+		resp.Metadata.Transaction = f.s.newTransaction()
+	}
+	return resp, nil
+}
+
+// PartitionQuery returns a single partition of the query, which returns the same result as the query.
+func (f *spannerServer) PartitionQuery(ctx context.Context, req *sppb.PartitionQueryRequest) (*sppb.PartitionResponse, error) {
+	return &sppb.PartitionResponse{
+		Partitions: []*sppb.Partition{{PartitionToken: []byte(fmt.Sprintf("partition-%d", f.s.nextID()))}},
+	}, nil
+}
+
+func (f *spannerServer) ExecuteStreamingSql(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	result, err := f.s.execute(req)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return status.Errorf(codes.InvalidArgument, "fakespanner: no result registered for %q", req.Sql)
+	}
+
+	metadata := proto.Clone(result.Metadata).(*sppb.ResultSetMetadata)
+	if transactionOptions(req.GetTransaction()) != nil {
+		metadata.Transaction = f.s.newTransaction()
+	}
+	partial := &sppb.PartialResultSet{Metadata: metadata}
+
+	f.s.mu.Lock()
+	streamErr := f.s.streamErrors[normalizeSQL(req.Sql)]
+	delete(f.s.streamErrors, normalizeSQL(req.Sql))
+	f.s.mu.Unlock()
+	if streamErr != nil {
+		for _, row := range result.Rows[:streamErr.rows] {
+			partial.Values = append(partial.Values, row.Values...)
+		}
+		// The resume token makes the client return the rows before the error.
+		partial.ResumeToken = []byte("resume")
+		if err := stream.Send(partial); err != nil {
+			return err
+		}
+		return streamErr.err
+	}
+
+	for _, row := range result.Rows {
+		partial.Values = append(partial.Values, row.Values...)
+	}
+	if req.QueryMode == sppb.ExecuteSqlRequest_PROFILE {
+		partial.Stats = result.Stats
+	}
+	return stream.Send(partial)
+}
+
+type adminServer struct {
+	adminpb.UnimplementedDatabaseAdminServer
+	s *Server
+}
+
+func (f *adminServer) GetDatabaseDdl(ctx context.Context, req *adminpb.GetDatabaseDdlRequest) (*adminpb.GetDatabaseDdlResponse, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if err, ok := f.s.dbErrors[req.Database]; ok {
+		return nil, err
+	}
+	ddls, ok := f.s.ddls[req.Database]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "database not found: %s", req.Database)
+	}
+	return &adminpb.GetDatabaseDdlResponse{Statements: ddls, ProtoDescriptors: f.s.descriptors[req.Database]}, nil
+}
+
+func (f *adminServer) GetDatabase(ctx context.Context, req *adminpb.GetDatabaseRequest) (*adminpb.Database, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if _, ok := f.s.ddls[req.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "database not found: %s", req.Name)
+	}
+	db := &adminpb.Database{Name: req.Name, State: adminpb.Database_READY, VersionRetentionPeriod: "1h"}
+	if r, ok := f.s.retention[req.Name]; ok {
+		db.VersionRetentionPeriod = r.VersionRetentionPeriod
+		db.EarliestVersionTime = r.EarliestVersionTime
+	}
+	return db, nil
+}
+
+func (f *adminServer) ListDatabases(ctx context.Context, req *adminpb.ListDatabasesRequest) (*adminpb.ListDatabasesResponse, error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	resp := &adminpb.ListDatabasesResponse{}
+	for name := range f.s.ddls {
+		if strings.HasPrefix(name, req.Parent+"/databases/") {
+			resp.Databases = append(resp.Databases, &adminpb.Database{Name: name, State: adminpb.Database_READY})
+		}
+	}
+	sort.Slice(resp.Databases, func(i, j int) bool { return resp.Databases[i].Name < resp.Databases[j].Name })
+	return resp, nil
+}
+
+func (f *adminServer) UpdateDatabaseDdl(ctx context.Context, req *adminpb.UpdateDatabaseDdlRequest) (*lropb.Operation, error) {
+	f.s.mu.Lock()
+	f.s.ddls[req.Database] = append(f.s.ddls[req.Database], req.Statements...)
+	if req.ProtoDescriptors != nil {
+		f.s.descriptors[req.Database] = req.ProtoDescriptors
+	}
+	f.s.mu.Unlock()
+
+	resp, err := anypb.New(&emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return &lropb.Operation{
+		Name:   fmt.Sprintf("%s/operations/%d", req.Database, f.s.nextID()),
+		Done:   true,
+		Result: &lropb.Operation_Response{Response: resp},
+	}, nil
+}
+
+// NewResultSet creates a result set with the given columns and rows.
+func NewResultSet(fields []*sppb.StructType_Field, rows ...[]*structpb.Value) *sppb.ResultSet {
+	rs := &sppb.ResultSet{
+		Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: fields}},
+	}
+	for _, row := range rows {
+		rs.Rows = append(rs.Rows, &structpb.ListValue{Values: row})
+	}
+	return rs
+}
+
+// Field creates a column definition of a result set.
+func Field(name string, typ *sppb.Type) *sppb.StructType_Field {
+	return &sppb.StructType_Field{Name: name, Type: typ}
+}
+
+// Type returns a Spanner type of the given code.
+func Type(code sppb.TypeCode) *sppb.Type {
+	return &sppb.Type{Code: code}
+}
+
+// ArrayType returns a Spanner array type of the given element type code.
+func ArrayType(code sppb.TypeCode) *sppb.Type {
+	return &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: Type(code)}
+}
+
+// StringValue returns a value in the Spanner wire format for STRING and other string-encoded types.
+func StringValue(s string) *structpb.Value {
+	return structpb.NewStringValue(s)
+}
+
+// IntValue returns a value in the Spanner wire format for INT64.
+func IntValue(i int64) *structpb.Value {
+	return structpb.NewStringValue(fmt.Sprint(i))
+}
+
+// BoolValue returns a value in the Spanner wire format for BOOL.
+func BoolValue(b bool) *structpb.Value {
+	return structpb.NewBoolValue(b)
+}
+
+// NullValue returns a NULL value.
+func NullValue() *structpb.Value {
+	return structpb.NewNullValue()
+}
+
+// ListValue returns a value in the Spanner wire format for ARRAY.
+func ListValue(values ...*structpb.Value) *structpb.Value {
+	return structpb.NewListValue(&structpb.ListValue{Values: values})
+}
+
+// StringListValue returns a value in the Spanner wire format for ARRAY<STRING>.
+func StringListValue(ss ...string) *structpb.Value {
+	values := make([]*structpb.Value, len(ss))
+	for i, s := range ss {
+		values[i] = StringValue(s)
+	}
+	return ListValue(values...)
+}
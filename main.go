@@ -19,71 +19,496 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
 	"github.com/jessevdk/go-flags"
+	"google.golang.org/grpc/codes"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
 )
 
 type options struct {
-	ProjectId  string `short:"p" long:"project" env:"SPANNER_PROJECT_ID" description:"(required) GCP Project ID."`
-	InstanceId string `short:"i" long:"instance" env:"SPANNER_INSTANCE_ID" description:"(required) Cloud Spanner Instance ID."`
-	DatabaseId string `short:"d" long:"database" env:"SPANNER_DATABASE_ID" description:"(required) Cloud Spanner Database ID."`
-	Tables     string `long:"tables" description:"comma-separated table names, e.g. \"table1,table2\" "`
-	NoDDL      bool   `long:"no-ddl" description:"No DDL information."`
-	NoData     bool   `long:"no-data" description:"Do not dump data."`
-	Timestamp  string `long:"timestamp" description:"Timestamp for database snapshot in the RFC 3339 format."`
-	BulkSize   uint   `long:"bulk-size" description:"Bulk size for values in a single INSERT statement."`
+	ProjectId              string `short:"p" long:"project" env:"SPANNER_PROJECT_ID" description:"(required) GCP Project ID."`
+	InstanceId             string `short:"i" long:"instance" env:"SPANNER_INSTANCE_ID" description:"(required) Cloud Spanner Instance ID."`
+	DatabaseId             string `short:"d" long:"database" env:"SPANNER_DATABASE_ID" description:"(required) Cloud Spanner Database ID."`
+	Databases              string `long:"databases" description:"comma-separated database IDs to dump into their own subdirectories of --output-dir, instead of -d."`
+	AllDatabases           bool   `long:"all-databases" description:"Dump all databases in the instance into their own subdirectories of --output-dir, instead of -d."`
+	Concurrency            uint   `long:"concurrency" description:"Maximum number of databases dumped concurrently with --databases or --all-databases. Default is 4."`
+	Config                 string `long:"config" description:"YAML config file with named profiles of options. Default is ~/.config/spanner-dump/config.yaml if it exists."`
+	Profile                string `long:"profile" env:"SPANNER_DUMP_PROFILE" description:"Profile in the config file to read options from. Flags and environment variables override the profile. Default is \"default\"."`
+	CredentialsFile        string `long:"credentials-file" description:"JSON credentials file, e.g. a service account key, used instead of Application Default Credentials."`
+	Endpoint               string `long:"endpoint" description:"Endpoint of Cloud Spanner, e.g. a private endpoint or \"localhost:9010\" of the emulator."`
+	ImpersonateSA          string `long:"impersonate-service-account" description:"Email address of the service account to impersonate."`
+	Insecure               bool   `long:"insecure" description:"Connect to --endpoint without TLS and authentication, e.g. to the emulator."`
+	Tables                 string `long:"tables" description:"comma-separated table names, e.g. \"table1,table2\" "`
+	Objects                string `long:"objects" description:"comma-separated object types of DDLs, e.g. \"tables,views\". Available types: tables, views, change-streams, sequences, roles, schemas, models, functions, proto-bundles, database-options. Default is all."`
+	NoDDL                  bool   `long:"no-ddl" description:"No DDL information."`
+	NoData                 bool   `long:"no-data" description:"Do not dump data."`
+	Timestamp              string `long:"timestamp" description:"Timestamp for database snapshot in the RFC 3339 format, or relative to the current time, e.g. \"-1h\"."`
+	Staleness              string `long:"staleness" description:"Read the database snapshot at the exact staleness, e.g. \"15s\"."`
+	MaxStaleness           string `long:"max-staleness" description:"Read the database snapshot at a timestamp within the bounded staleness chosen by Cloud Spanner, e.g. \"15s\"."`
+	BulkSize               uint   `long:"bulk-size" description:"Bulk size for values in a single INSERT statement."`
+	Format                 string `long:"format" description:"Output format for table records: sql, csv or json. Default is sql."`
+	CSVNull                string `long:"csv-null" description:"Field written for NULL with --format=csv, e.g. \"\\N\". Default is an empty field, which is the same as an empty string."`
+	PendingCommitTimestamp bool   `long:"pending-commit-timestamp" description:"Write values of commit timestamp columns as PENDING_COMMIT_TIMESTAMP() in INSERT statements."`
+	OmitDefaultColumns     bool   `long:"omit-default-columns" description:"Omit columns which have default values, except primary key columns, so that they are computed on restore."`
+	UnsupportedTypes       string `long:"unsupported-types" description:"How to handle columns of types which can't be dumped: error, skip or null. Default is error, which fails before dumping any data."`
+	Progress               bool   `long:"progress" description:"Show progress of dumping tables with an estimated remaining time on stderr. Rows of the tables are counted in advance."`
+	RequestTag             string `long:"request-tag" description:"Prefix of request tags of queries, which are like \"<prefix>/<table>\". Default is spanner-dump."`
+	Priority               string `long:"priority" description:"Priority of queries: low, medium or high. Default is low."`
+	DataBoost              bool   `long:"data-boost" description:"Read tables by partitioned queries with Data Boost, which run on independent compute resources without impacting serving traffic."`
+	MaxRetries             uint   `long:"max-retries" description:"Maximum number of retries of a table query failed with a transient error, e.g. an aborted stream, which resume after the last dumped primary key. Tables are read in primary key order if set. Can't be used with --data-boost. Default is 0, no retries."`
+	RetryBackoff           string `long:"retry-backoff" description:"Delay before the first retry of a table, doubled for each subsequent retry, e.g. \"500ms\". Default is 1s."`
+	DirectedRead           string `long:"directed-read" description:"Direct queries to replicas, e.g. \"region:us-east1,type:READ_ONLY\". Replica selections in the order of preference are separated by semicolons."`
+	DatabaseRole           string `long:"database-role" description:"Database role of fine-grained access control to access the database as. Tables and columns which the role can't read are skipped with warnings."`
+	Stats                  string `long:"stats" description:"Write statistics of the dump in JSON into the file, including row counts, bytes and query statistics of each table."`
+	OTLPEndpoint           string `long:"otlp-endpoint" description:"Export traces and metrics to the OTLP gRPC endpoint, e.g. \"localhost:4317\". Other settings are read from OTEL_EXPORTER_OTLP_* environment variables."`
+	TelemetryFile          string `long:"telemetry-file" description:"Write traces and metrics into the file in JSON."`
+	OutputDir              string `long:"output-dir" description:"Write the dump into the directory with checksums for verification, instead of stdout."`
+	ProtoDescriptorsFile   string `long:"proto-descriptors-file" description:"Write the proto descriptors of the proto bundle into the file, which is required to restore PROTO and ENUM columns."`
 }
 
+// Files in the output directory.
+const (
+	schemaFile       = "schema.sql"
+	dataFilePrefix   = "data."
+	manifestFile     = "manifest.json"
+	rowChecksumsFile = "checksums.tsv"
+	descriptorsFile  = "descriptors.pb"
+
+	// instanceManifestFile is written into the output directory of multiple databases.
+	instanceManifestFile = "instance-manifest.json"
+)
+
 func main() {
 	var opts options
+	var verifyOpts verifyOptions
+	var diffOpts diffOptions
+	var schemaDiffOpts schemaDiffOptions
 
-	if _, err := flags.Parse(&opts); err != nil {
-		exitf("Invalid options\n")
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand("verify", "Verify a dump", "Verify a dump created with --output-dir by comparing it to the database.", &verifyOpts); err != nil {
+		exitf("Failed to initialize: %v\n", err)
+	}
+	if _, err := parser.AddCommand("diff", "Compare data", "Compare data of the database with another database or another snapshot, in primary key order.", &diffOpts); err != nil {
+		exitf("Failed to initialize: %v\n", err)
+	}
+	if _, err := parser.AddCommand("schema-diff", "Compare schemas", "Compare the schema of the database with another database or a SQL file, and output DDL statements to migrate the database into it.", &schemaDiffOpts); err != nil {
+		exitf("Failed to initialize: %v\n", err)
+	}
+	if _, err := parser.Parse(); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0) // the help message is printed by the parser
+		}
+		usagef("Invalid options\n")
+	}
+	if err := applyConfig(parser, &opts); err != nil {
+		usagef("Failed to read config: %v\n", err)
 	}
 
-	if opts.ProjectId == "" || opts.InstanceId == "" || opts.DatabaseId == "" {
-		exitf("Missing parameters: -p, -i, -d are required\n")
+	multiDatabase := opts.AllDatabases || opts.Databases != ""
+	// -d from the environment variable or the config file is ignored for multiple databases, but the flag is an error.
+	if opt := parser.FindOptionByLongName("database"); multiDatabase && opt.IsSet() && !opt.IsSetDefault() {
+		usagef("-d can't be used with --databases or --all-databases\n")
+	}
+	if opts.ProjectId == "" || opts.InstanceId == "" || (opts.DatabaseId == "" && !multiDatabase) {
+		usagef("Missing parameters: -p, -i, -d are required\n")
 	}
 
-	var timestamp *time.Time
-	if opts.Timestamp != "" {
-		t, err := time.Parse(time.RFC3339, opts.Timestamp)
-		if err != nil {
-			exitf("Failed to parse timestamp: %v\n", err)
+	timestamp := parseTimestamp(opts.Timestamp)
+	staleness := parseDuration("--staleness", opts.Staleness)
+	maxStaleness := parseDuration("--max-staleness", opts.MaxStaleness)
+	retryBackoff := parseDuration("--retry-backoff", opts.RetryBackoff)
+	priority := parsePriority(opts.Priority)
+	if opts.CSVNull != "" && opts.Format != dump.FormatCSV {
+		usagef("--csv-null can be used only with --format=csv\n")
+	}
+	if opts.MaxRetries > 0 && opts.DataBoost {
+		usagef("--max-retries can't be used with --data-boost, as partitioned queries can't be resumed\n")
+	}
+	var directedRead *sppb.DirectedReadOptions
+	if opts.DirectedRead != "" {
+		var err error
+		if directedRead, err = dump.ParseDirectedReadOptions(opts.DirectedRead); err != nil {
+			usagef("Invalid --directed-read: %v\n", err)
 		}
-		timestamp = &t
 	}
 
 	var tables []string
 	if opts.Tables != "" {
 		tables = strings.Split(opts.Tables, ",")
 	}
+	var objects []string
+	if opts.Objects != "" {
+		objects = strings.Split(opts.Objects, ",")
+	}
+
+	dumpOpts := dump.Options{
+		Project:   opts.ProjectId,
+		Instance:  opts.InstanceId,
+		Database:  opts.DatabaseId,
+		Out:       os.Stdout,
+		Tables:    tables,
+		Objects:   objects,
+		Timestamp: timestamp,
+		BulkSize:  opts.BulkSize,
+		Format:    opts.Format,
+
+		CredentialsFile:           opts.CredentialsFile,
+		Endpoint:                  opts.Endpoint,
+		ImpersonateServiceAccount: opts.ImpersonateSA,
+		Insecure:                  opts.Insecure,
+
+		Staleness:              staleness,
+		MaxStaleness:           maxStaleness,
+		PendingCommitTimestamp: opts.PendingCommitTimestamp,
+		OmitDefaultColumns:     opts.OmitDefaultColumns,
+		CSVNull:                opts.CSVNull,
+		UnsupportedTypes:       opts.UnsupportedTypes,
+		RequestTag:             opts.RequestTag,
+		Priority:               priority,
+		DataBoost:              opts.DataBoost,
+		MaxRetries:             opts.MaxRetries,
+		RetryBackoff:           retryBackoff,
+		DirectedReadOptions:    directedRead,
+		DatabaseRole:           opts.DatabaseRole,
+		Warnings:               os.Stderr,
+	}
+	if opts.Progress {
+		dumpOpts.Progress = os.Stderr
+	}
+	dumpOpts.CollectStats = opts.Stats != ""
+
+	// SIGINT and SIGTERM cancel the dump, so that the output is flushed and marked as incomplete.
+	// A second signal terminates the program immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	defer runExitHooks()
+
+	shutdown, err := setupTelemetry(ctx, opts.OTLPEndpoint, opts.TelemetryFile)
+	if err != nil {
+		exitf("Failed to set up telemetry: %v\n", err)
+	}
+	if shutdown != nil {
+		exitHooks = append(exitHooks, func() {
+			if err := shutdown(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to export telemetry: %v\n", err)
+			}
+		})
+	}
+
+	if parser.Active != nil {
+		if multiDatabase {
+			usagef("--databases and --all-databases can't be used with %s\n", parser.Active.Name)
+		}
+		switch parser.Active.Name {
+		case "verify":
+			runVerify(ctx, dumpOpts, verifyOpts)
+		case "diff":
+			runDiff(ctx, dumpOpts, diffOpts)
+		case "schema-diff":
+			runSchemaDiff(ctx, dumpOpts, schemaDiffOpts)
+		}
+		return
+	}
+
+	if multiDatabase {
+		runDumpDatabases(ctx, dumpOpts, opts)
+		return
+	}
 
-	ctx := context.Background()
-	dumper, err := NewDumper(ctx, opts.ProjectId, opts.InstanceId, opts.DatabaseId, os.Stdout, timestamp, opts.BulkSize, tables)
+	if opts.OutputDir != "" {
+		if _, err := dumpToDir(ctx, dumpOpts, opts); err != nil {
+			exitWithCode(exitCode(ctx, err), "Failed to dump: %v\n", err)
+		}
+		return
+	}
+
+	if opts.Format != "" && opts.Format != dump.FormatSQL && !opts.NoDDL && !opts.NoData {
+		usagef("--format=%s can't be used with DDLs, please specify --no-ddl\n", opts.Format)
+	}
+
+	dumper, err := dump.NewDumper(ctx, dumpOpts)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+	}
+	exitHooks = append(exitHooks, dumper.Cleanup)
+
+	if !opts.NoDDL {
+		if err := dumper.DumpDDLs(ctx); err != nil {
+			writeIncompleteMarker(os.Stdout, err)
+			exitWithCode(exitCode(ctx, err), "Failed to dump DDLs: %v\n", err)
+		}
+		if opts.ProtoDescriptorsFile != "" {
+			if err := writeProtoDescriptors(ctx, dumper, opts.ProtoDescriptorsFile, true); err != nil {
+				writeIncompleteMarker(os.Stdout, err)
+				exitf("Failed to write proto descriptors: %v\n", err)
+			}
+		}
+	}
+
+	if !opts.NoData {
+		if err := dumper.DumpTables(ctx); err != nil {
+			if opts.Format == "" || opts.Format == dump.FormatSQL {
+				writeIncompleteMarker(os.Stdout, err)
+			}
+			exitWithCode(exitCode(ctx, err), "Failed to dump tables: %v\n", err)
+		}
+		if err := writeStats(dumper, opts.Stats); err != nil {
+			exitf("Failed to write stats: %v\n", err)
+		}
+	}
+}
+
+// writeIncompleteMarker writes an SQL comment at the end of the dump, so that a truncated dump isn't mistaken
+// for a complete one. Statements before it are complete, as rows which have been read are flushed.
+func writeIncompleteMarker(w io.Writer, err error) {
+	fmt.Fprintf(w, "-- INCOMPLETE: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+}
+
+// dumpToDir dumps DDLs and data into separate files in the output directory,
+// and writes a manifest and row checksums for verification.
+// If the dump fails after the dumper is created, the manifest is written with StatusIncomplete and returned with the error.
+// If it fails after the files are created, schema.sql and the data file in SQL end with the incomplete marker.
+func dumpToDir(ctx context.Context, dumpOpts dump.Options, opts options) (manifest *dump.Manifest, err error) {
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = dump.FormatSQL
+	}
+	schema, err := os.Create(filepath.Join(opts.OutputDir, schemaFile))
+	if err != nil {
+		return nil, err
+	}
+	defer schema.Close()
+	data, err := os.Create(filepath.Join(opts.OutputDir, dataFilePrefix+format))
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	rowChecksums, err := os.Create(filepath.Join(opts.OutputDir, rowChecksumsFile))
 	if err != nil {
-		exitf("Failed to create dumper: %v\n", err)
+		return nil, err
+	}
+	defer rowChecksums.Close()
+	defer func() {
+		if err != nil {
+			writeIncompleteMarker(schema, err)
+			if format == dump.FormatSQL {
+				writeIncompleteMarker(data, err)
+			}
+		}
+	}()
+
+	counter := dump.NewByteCounter(data)
+	encoder, err := dump.NewEncoder(format, counter, dump.EncoderOptions{
+		BulkSize:               opts.BulkSize,
+		PendingCommitTimestamp: opts.PendingCommitTimestamp,
+		OmitDefaultColumns:     opts.OmitDefaultColumns,
+		CSVNull:                opts.CSVNull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dumper: %v", err)
+	}
+	checksumEncoder := dump.NewChecksumEncoder(rowChecksums)
+	dumpOpts.Out = schema
+	dumpOpts.Encoder = dump.MultiEncoder(encoder, checksumEncoder)
+	dumpOpts.BytesWritten = counter.Count
+
+	dumper, err := dump.NewDumper(ctx, dumpOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dumper: %w", err)
 	}
 	defer dumper.Cleanup()
 
+	dumpErr := dumpFiles(ctx, dumper, opts)
+	manifest = &dump.Manifest{
+		Database:         dumper.DatabasePath(),
+		ReadTimestamp:    dumper.ReadTimestamp(),
+		Tables:           checksumEncoder.Checksums(),
+		UnsupportedTypes: dumpOpts.UnsupportedTypes,
+		DatabaseRole:     dumpOpts.DatabaseRole,
+		Status:           dump.StatusComplete,
+	}
+	if dumpErr != nil {
+		// The manifest is written even if the dump fails, so that the incomplete dump isn't verified as complete.
+		manifest.Status = dump.StatusIncomplete
+		manifest.Error = dumpErr.Error()
+	}
+	f, err := os.Create(filepath.Join(opts.OutputDir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := manifest.Write(f); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return manifest, dumpErr
+}
+
+// dumpFiles dumps DDLs, proto descriptors and data of the database into the files of the output directory.
+func dumpFiles(ctx context.Context, dumper *dump.Dumper, opts options) error {
 	if !opts.NoDDL {
 		if err := dumper.DumpDDLs(ctx); err != nil {
-			exitf("Failed to dump DDLs: %v\n", err)
+			return fmt.Errorf("failed to dump DDLs: %w", err)
+		}
+		path := opts.ProtoDescriptorsFile
+		if path == "" {
+			path = filepath.Join(opts.OutputDir, descriptorsFile)
+		}
+		if err := writeProtoDescriptors(ctx, dumper, path, opts.ProtoDescriptorsFile != ""); err != nil {
+			return fmt.Errorf("failed to write proto descriptors: %w", err)
 		}
 	}
 
 	if !opts.NoData {
 		if err := dumper.DumpTables(ctx); err != nil {
-			exitf("Failed to dump tables: %v\n", err)
+			return fmt.Errorf("failed to dump tables: %w", err)
+		}
+		if err := writeStats(dumper, opts.Stats); err != nil {
+			return fmt.Errorf("failed to write stats: %v", err)
 		}
 	}
+	return nil
+}
+
+// writeStats writes the stats of the dump into the file, and its summary to stderr. It does nothing if path is empty.
+func writeStats(dumper *dump.Dumper, path string) error {
+	if path == "" {
+		return nil
+	}
+	stats := dumper.Stats()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := stats.Write(f); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, stats.Summary())
+	return nil
+}
+
+// writeProtoDescriptors writes the proto descriptors of the database into the file.
+// If the database has no proto bundle, the file is written only if always is true.
+func writeProtoDescriptors(ctx context.Context, dumper *dump.Dumper, path string, always bool) error {
+	descriptors, err := dumper.ProtoDescriptors(ctx)
+	if err != nil {
+		return err
+	}
+	if len(descriptors) == 0 && !always {
+		return nil
+	}
+	return os.WriteFile(path, descriptors, 0644)
+}
+
+// parseTimestamp parses a timestamp in the RFC 3339 format, or a negative duration relative to the current time.
+// It returns nil for an empty string.
+func parseTimestamp(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	if strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			usagef("Failed to parse relative timestamp: %v\n", err)
+		}
+		t := time.Now().Add(d)
+		return &t
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		usagef("Failed to parse timestamp: %v\n", err)
+	}
+	return &t
+}
+
+func parseDuration(flag, s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		usagef("Failed to parse %s: %v\n", flag, err)
+	}
+	return d
+}
+
+func parsePriority(s string) sppb.RequestOptions_Priority {
+	switch s {
+	case "", "low":
+		return sppb.RequestOptions_PRIORITY_LOW
+	case "medium":
+		return sppb.RequestOptions_PRIORITY_MEDIUM
+	case "high":
+		return sppb.RequestOptions_PRIORITY_HIGH
+	default:
+		usagef("Invalid priority: %q, must be low, medium or high\n", s)
+		return sppb.RequestOptions_PRIORITY_UNSPECIFIED
+	}
+}
+
+// exitHooks are functions to run before the program exits, as deferred functions don't run on os.Exit.
+var exitHooks []func()
+
+func runExitHooks() {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	exitHooks = nil
+}
+
+// Exit codes, which tell scripts why the program failed.
+const (
+	exitError      = 1 // any other failure
+	exitUsage      = 2 // invalid options
+	exitPermission = 3 // permission denied or unauthenticated
+	exitIncomplete = 4 // the dump was interrupted or failed while writing tables, and is incomplete
+)
+
+// exitCode returns the exit code for the error of a dump.
+// Permission errors take precedence, as retrying an incomplete dump doesn't help with them.
+func exitCode(ctx context.Context, err error) int {
+	switch spanner.ErrCode(err) {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return exitPermission
+	}
+	var incomplete *dump.IncompleteError
+	if ctx.Err() != nil || errors.As(err, &incomplete) {
+		return exitIncomplete
+	}
+	return exitError
 }
 
 func exitf(format string, a ...interface{}) {
+	exitWithCode(exitError, format, a...)
+}
+
+func usagef(format string, a ...interface{}) {
+	exitWithCode(exitUsage, format, a...)
+}
+
+func exitWithCode(code int, format string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, format, a...)
-	os.Exit(1)
+	runExitHooks()
+	os.Exit(code)
 }
@@ -0,0 +1,234 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+	"github.com/cloudspannerecosystem/spanner-dump/internal/fakespanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExitCode(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	denied := status.Error(codes.PermissionDenied, "permission denied")
+
+	for _, tt := range []struct {
+		desc string
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{
+			desc: "other error",
+			ctx:  context.Background(),
+			err:  errors.New("failed"),
+			want: exitError,
+		},
+		{
+			desc: "permission denied",
+			ctx:  context.Background(),
+			err:  fmt.Errorf("failed to dump DDLs: %w", denied),
+			want: exitPermission,
+		},
+		{
+			desc: "unauthenticated",
+			ctx:  context.Background(),
+			err:  status.Error(codes.Unauthenticated, "unauthenticated"),
+			want: exitPermission,
+		},
+		{
+			desc: "incomplete",
+			ctx:  context.Background(),
+			err:  &dump.IncompleteError{Table: "t1", Err: status.Error(codes.Unavailable, "unavailable")},
+			want: exitIncomplete,
+		},
+		{
+			desc: "incomplete by permission denied",
+			ctx:  context.Background(),
+			err:  fmt.Errorf("failed to dump tables: %w", &dump.IncompleteError{Table: "t1", Err: denied}),
+			want: exitPermission,
+		},
+		{
+			desc: "interrupted",
+			ctx:  canceled,
+			err:  fmt.Errorf("failed to dump DDLs: %w", context.Canceled),
+			want: exitIncomplete,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := exitCode(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("exitCode() = %d, want = %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpToDir_Incomplete(t *testing.T) {
+	server, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	defer server.Close()
+
+	// DDLs of the database aren't served, so the dump fails while dumping DDLs.
+	dir := t.TempDir()
+	dumpOpts := dump.Options{
+		Project:  "fake-project",
+		Instance: "fake-instance",
+		Database: "fake-database",
+		Endpoint: server.Addr(),
+		Insecure: true,
+	}
+	manifest, err := dumpToDir(context.Background(), dumpOpts, options{OutputDir: dir})
+	if err == nil {
+		t.Fatalf("dumpToDir() succeeded unexpectedly")
+	}
+	if manifest == nil || manifest.Status != dump.StatusIncomplete {
+		t.Errorf("manifest = %+v, want status %q", manifest, dump.StatusIncomplete)
+	}
+	for _, name := range []string{schemaFile, dataFilePrefix + dump.FormatSQL} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !strings.HasPrefix(string(b), "-- INCOMPLETE: failed to dump DDLs: ") {
+			t.Errorf("%s = %q, want incomplete marker", name, b)
+		}
+	}
+}
+
+// mainArgsEnv passes the arguments to the program run by runMain, separated by newlines.
+const mainArgsEnv = "SPANNER_DUMP_TEST_MAIN_ARGS"
+
+// TestMainProcess runs the program as the subprocess of runMain, and is skipped in the normal test run.
+func TestMainProcess(t *testing.T) {
+	args := os.Getenv(mainArgsEnv)
+	if args == "" {
+		t.Skip("run by runMain")
+	}
+	os.Args = append([]string{"spanner-dump"}, strings.Split(args, "\n")...)
+	main()
+}
+
+// runMain runs the program with the arguments in a subprocess, as it exits by os.Exit, and returns the exit code
+// and stderr. The config file and environment variables of the user are ignored.
+func runMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainProcess$")
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "SPANNER_") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, "XDG_CONFIG_HOME="+t.TempDir(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stderr.String()
+	}
+	if err != nil {
+		t.Fatalf("failed to run the program: %v", err)
+	}
+	return 0, stderr.String()
+}
+
+// writeTestManifest writes a manifest of a dump of t1 with the status into a new directory, and returns the directory.
+func writeTestManifest(t *testing.T, status string) string {
+	t.Helper()
+	dir := t.TempDir()
+	manifest := &dump.Manifest{
+		Database: "projects/fake-project/instances/fake-instance/databases/db1",
+		Tables:   []dump.TableChecksum{{Name: "t1"}},
+		Status:   status,
+	}
+	f, err := os.Create(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatalf("failed to create manifest: %v", err)
+	}
+	defer f.Close()
+	if err := manifest.Write(f); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, rowChecksumsFile), nil, 0644); err != nil {
+		t.Fatalf("failed to write row checksums: %v", err)
+	}
+	return dir
+}
+
+func TestMain_ExitCodes(t *testing.T) {
+	if os.Getenv(mainArgsEnv) != "" {
+		t.Skip("running as the program")
+	}
+	server, err := fakespanner.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start fake server: %v", err)
+	}
+	defer server.Close()
+	databasePath := func(database string) string {
+		return "projects/fake-project/instances/fake-instance/databases/" + database
+	}
+	ddls := []string{"CREATE TABLE t1 (\n  Id INT64 NOT NULL,\n) PRIMARY KEY(Id)"}
+	// db1 is readable except its tables, which aren't served, db2 is denied, and db3 doesn't exist.
+	server.SetDDLs(databasePath("db1"), ddls)
+	server.SetDDLs(databasePath("db2"), ddls)
+	server.SetDatabaseError(databasePath("db2"), status.Error(codes.PermissionDenied, "permission denied"))
+
+	connection := []string{"-p", "fake-project", "-i", "fake-instance", "--endpoint", server.Addr(), "--insecure"}
+	complete := writeTestManifest(t, dump.StatusComplete)
+	incomplete := writeTestManifest(t, dump.StatusIncomplete)
+
+	for _, tt := range []struct {
+		desc string
+		args []string
+		want int
+	}{
+		{desc: "help", args: []string{"--help"}, want: 0},
+		{desc: "invalid option", args: []string{"--unknown"}, want: exitUsage},
+		{desc: "csv-null without csv", args: []string{"-d", "db1", "--csv-null", "\\N"}, want: exitUsage},
+		{desc: "verify, error", args: []string{"-d", "db1", "verify", "--input", complete}, want: exitError},
+		{desc: "verify, permission denied", args: []string{"-d", "db2", "verify", "--input", complete}, want: exitPermission},
+		{desc: "verify, incomplete dump", args: []string{"-d", "db1", "verify", "--input", incomplete}, want: exitIncomplete},
+		{desc: "diff, missing target", args: []string{"-d", "db1", "diff"}, want: exitUsage},
+		{desc: "diff, error", args: []string{"-d", "db1", "diff", "--to-database", "db3"}, want: exitError},
+		{desc: "diff, permission denied", args: []string{"-d", "db2", "diff", "--to-database", "db1"}, want: exitPermission},
+		{desc: "schema-diff, missing target", args: []string{"-d", "db1", "schema-diff"}, want: exitUsage},
+		{desc: "schema-diff, error", args: []string{"-d", "db1", "schema-diff", "--to-database", "db3"}, want: exitError},
+		{desc: "schema-diff, permission denied", args: []string{"-d", "db1", "schema-diff", "--to-database", "db2"}, want: exitPermission},
+		{desc: "databases, failed", args: []string{"--databases", "db1,db3", "--no-data", "--output-dir", t.TempDir()}, want: exitIncomplete},
+		{desc: "databases, permission denied", args: []string{"--databases", "db1,db2,db3", "--no-data", "--output-dir", t.TempDir()}, want: exitPermission},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			args := append(append([]string{}, connection...), tt.args...)
+			if got, stderr := runMain(t, args...); got != tt.want {
+				t.Errorf("exit code = %d, want = %d, stderr = %q", got, tt.want, stderr)
+			}
+		})
+	}
+}
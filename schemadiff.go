@@ -0,0 +1,88 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+)
+
+type schemaDiffOptions struct {
+	ToProjectId  string `long:"to-project" description:"GCP Project ID of the target. Default is the same as the source."`
+	ToInstanceId string `long:"to-instance" description:"Cloud Spanner Instance ID of the target. Default is the same as the source."`
+	ToDatabaseId string `long:"to-database" description:"Cloud Spanner Database ID of the target."`
+	ToFile       string `long:"to-file" description:"SQL file of DDL statements as the target, e.g. schema.sql created with --output-dir."`
+}
+
+// runSchemaDiff compares the schema of the database specified by the application options with the target,
+// and writes DDL statements to migrate the database into the target.
+func runSchemaDiff(ctx context.Context, dumpOpts dump.Options, opts schemaDiffOptions) {
+	if (opts.ToDatabaseId == "") == (opts.ToFile == "") {
+		usagef("Missing parameters: either --to-database or --to-file is required\n")
+	}
+
+	from, err := dump.NewDumper(ctx, dumpOpts)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+	}
+	exitHooks = append(exitHooks, from.Cleanup)
+	fromDDLs, err := from.DDLs(ctx)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to get DDLs: %v\n", err)
+	}
+
+	var toDDLs []string
+	if opts.ToFile != "" {
+		b, err := os.ReadFile(opts.ToFile)
+		if err != nil {
+			exitf("Failed to read %s: %v\n", opts.ToFile, err)
+		}
+		toDDLs, err = dump.SplitStatements(string(b))
+		if err != nil {
+			exitf("Failed to parse %s: %v\n", opts.ToFile, err)
+		}
+	} else {
+		toOpts := dumpOpts
+		toOpts.Database = opts.ToDatabaseId
+		if opts.ToProjectId != "" {
+			toOpts.Project = opts.ToProjectId
+		}
+		if opts.ToInstanceId != "" {
+			toOpts.Instance = opts.ToInstanceId
+		}
+		to, err := dump.NewDumper(ctx, toOpts)
+		if err != nil {
+			exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+		}
+		exitHooks = append(exitHooks, to.Cleanup)
+		toDDLs, err = to.DDLs(ctx)
+		if err != nil {
+			exitWithCode(exitCode(ctx, err), "Failed to get DDLs: %v\n", err)
+		}
+	}
+
+	changes, err := dump.SchemaDiff(fromDDLs, toDDLs)
+	if err != nil {
+		exitf("Failed to compare schemas: %v\n", err)
+	}
+	for _, c := range changes {
+		fmt.Print(c.String())
+	}
+}
@@ -0,0 +1,90 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// setupTelemetry sets the global OpenTelemetry providers which export traces and metrics to the OTLP endpoint
+// or the file. It returns a function to flush and shut down the providers, which is nil if neither is given.
+func setupTelemetry(ctx context.Context, endpoint, file string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var metricExporter sdkmetric.Exporter
+	var closeFile func() error
+	switch {
+	case endpoint != "" && file != "":
+		return nil, errors.New("--otlp-endpoint and --telemetry-file can't be used together")
+	case endpoint != "":
+		// Other settings, e.g. OTEL_EXPORTER_OTLP_INSECURE and OTEL_EXPORTER_OTLP_HEADERS, are read from environment variables.
+		var err error
+		if spanExporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint)); err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+		}
+		if metricExporter, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(endpoint)); err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %v", err)
+		}
+	case file != "":
+		f, err := os.Create(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create telemetry file: %v", err)
+		}
+		closeFile = f.Close
+		if spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(f)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+		}
+		if metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(f)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create metric exporter: %v", err)
+		}
+	default:
+		return nil, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("spanner-dump")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telemetry resource: %v", err)
+	}
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,101 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudspannerecosystem/spanner-dump/dump"
+)
+
+type verifyOptions struct {
+	Input string `long:"input" required:"true" description:"(required) Directory of a dump created with --output-dir."`
+}
+
+// runVerify compares the dump in the input directory with the database, and exits with an error if they differ.
+func runVerify(ctx context.Context, dumpOpts dump.Options, opts verifyOptions) {
+	f, err := os.Open(filepath.Join(opts.Input, manifestFile))
+	if err != nil {
+		exitf("Failed to open manifest: %v\n", err)
+	}
+	manifest, err := dump.ReadManifest(f)
+	f.Close()
+	if err != nil {
+		exitf("Failed to read manifest: %v\n", err)
+	}
+	if manifest.Status == dump.StatusIncomplete {
+		exitWithCode(exitIncomplete, "The dump in %s is incomplete: %s\n", opts.Input, manifest.Error)
+	}
+
+	if dumpOpts.DatabaseRole == "" {
+		// Tables are read with the same database role as the dump by default.
+		dumpOpts.DatabaseRole = manifest.DatabaseRole
+	}
+
+	rowChecksums, err := os.Open(filepath.Join(opts.Input, rowChecksumsFile))
+	if err != nil {
+		exitf("Failed to open row checksums: %v\n", err)
+	}
+	defer rowChecksums.Close()
+
+	dumper, err := dump.NewDumper(ctx, dumpOpts)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to create dumper: %v\n", err)
+	}
+	exitHooks = append(exitHooks, dumper.Cleanup)
+
+	mismatches, err := dumper.Verify(ctx, manifest, rowChecksums)
+	if err != nil {
+		exitWithCode(exitCode(ctx, err), "Failed to verify: %v\n", err)
+	}
+
+	mismatched := map[string]bool{}
+	for _, m := range mismatches {
+		mismatched[m.Dumped.Name] = true
+		if m.MissingTable {
+			fmt.Printf("MISMATCH %s: %d rows (checksum %s) in dump, table is missing in database\n",
+				m.Dumped.Name, m.Dumped.Rows, m.Dumped.Checksum)
+			printKeys("missing in database", m.MissingKeys)
+			continue
+		}
+		fmt.Printf("MISMATCH %s: %d rows (checksum %s) in dump, %d rows (checksum %s) in database\n",
+			m.Dumped.Name, m.Dumped.Rows, m.Dumped.Checksum, m.Actual.Rows, m.Actual.Checksum)
+		printKeys("missing in database", m.MissingKeys)
+		printKeys("extra in database", m.ExtraKeys)
+		printKeys("changed", m.ChangedKeys)
+	}
+	for _, t := range manifest.Tables {
+		if !mismatched[t.Name] {
+			fmt.Printf("OK %s: %d rows\n", t.Name, t.Rows)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		exitf("%d of %d tables don't match\n", len(mismatches), len(manifest.Tables))
+	}
+}
+
+func printKeys(kind string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	fmt.Printf("  %s: %s\n", kind, strings.Join(keys, ", "))
+}